@@ -0,0 +1,281 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// aggregatorState accumulates one column's aggregate value for a single
+// group-by row as the cursor loop visits events. A fresh aggregatorState is
+// created per row key per column, so it holds whatever state the aggregate
+// needs beyond a single running float (e.g. the sample buffer for
+// percentile, or the running mean/M2 for stddev).
+type aggregatorState interface {
+	Add(v interface{}, ts int64)
+	Result() interface{}
+}
+
+// newAggregatorState builds the aggregatorState for a ColumnDesc.Aggregate
+// value. "percentile:P", with P a float in [0, 100], selects a percentile
+// aggregator over P.
+func newAggregatorState(aggregate string) (aggregatorState, error) {
+	if strings.HasPrefix(aggregate, "percentile:") {
+		p, err := strconv.ParseFloat(strings.TrimPrefix(aggregate, "percentile:"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile aggregate %q: %v", aggregate, err)
+		}
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentile must be between 0 and 100, got %v", p)
+		}
+		return &percentileAggregator{p: p}, nil
+	}
+
+	switch aggregate {
+	case "sum":
+		return &sumAggregator{}, nil
+	case "count":
+		return &countAggregator{}, nil
+	case "min":
+		return &minAggregator{}, nil
+	case "max":
+		return &maxAggregator{}, nil
+	case "avg":
+		return &avgAggregator{}, nil
+	case "stddev":
+		return &stddevAggregator{}, nil
+	case "first":
+		return &firstLastAggregator{first: true}, nil
+	case "last":
+		return &firstLastAggregator{first: false}, nil
+	case "distinct":
+		return &distinctAggregator{seen: map[string]interface{}{}}, nil
+	case "count_distinct":
+		return &distinctAggregator{seen: map[string]interface{}{}, countOnly: true}, nil
+	}
+
+	return nil, fmt.Errorf("unknown aggregate %q", aggregate)
+}
+
+// updateAggregateRow feeds event's columns into rows[rowKey], creating a
+// fresh aggregatorState per column the first time rowKey is seen.
+func updateAggregateRow(desc QueryDesc, event Event, ts int64, rowKey string, rows map[string][]aggregatorState) error {
+	rowAggregates, ok := rows[rowKey]
+	if !ok {
+		rowAggregates = make([]aggregatorState, len(desc.Columns))
+		for i, columnDesc := range desc.Columns {
+			agg, err := newAggregatorState(columnDesc.Aggregate)
+			if err != nil {
+				return err
+			}
+			rowAggregates[i] = agg
+		}
+		rows[rowKey] = rowAggregates
+	}
+
+	for i, columnDesc := range desc.Columns {
+		rowAggregates[i].Add(event[columnDesc.Name], ts)
+	}
+
+	return nil
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	}
+	return 0
+}
+
+type sumAggregator struct {
+	sum float64
+}
+
+func (a *sumAggregator) Add(v interface{}, ts int64) { a.sum += toFloat(v) }
+func (a *sumAggregator) Result() interface{}         { return a.sum }
+
+type countAggregator struct {
+	count float64
+}
+
+func (a *countAggregator) Add(v interface{}, ts int64) { a.count++ }
+func (a *countAggregator) Result() interface{}         { return a.count }
+
+type minAggregator struct {
+	min float64
+	set bool
+}
+
+func (a *minAggregator) Add(v interface{}, ts int64) {
+	f := toFloat(v)
+	if !a.set || f < a.min {
+		a.min = f
+		a.set = true
+	}
+}
+func (a *minAggregator) Result() interface{} {
+	if !a.set {
+		return math.NaN()
+	}
+	return a.min
+}
+
+type maxAggregator struct {
+	max float64
+	set bool
+}
+
+func (a *maxAggregator) Add(v interface{}, ts int64) {
+	f := toFloat(v)
+	if !a.set || f > a.max {
+		a.max = f
+		a.set = true
+	}
+}
+func (a *maxAggregator) Result() interface{} {
+	if !a.set {
+		return math.NaN()
+	}
+	return a.max
+}
+
+// avgAggregator maintains a running sum and count, dividing only at Result
+// so the cursor loop never has to hold more than two floats per row.
+type avgAggregator struct {
+	sum   float64
+	count float64
+}
+
+func (a *avgAggregator) Add(v interface{}, ts int64) {
+	a.sum += toFloat(v)
+	a.count++
+}
+func (a *avgAggregator) Result() interface{} {
+	if a.count == 0 {
+		return math.NaN()
+	}
+	return a.sum / a.count
+}
+
+// stddevAggregator computes the sample standard deviation with Welford's
+// online algorithm, so it never needs to buffer the column's values.
+type stddevAggregator struct {
+	n    int64
+	mean float64
+	m2   float64
+}
+
+func (a *stddevAggregator) Add(v interface{}, ts int64) {
+	a.n++
+	f := toFloat(v)
+	delta := f - a.mean
+	a.mean += delta / float64(a.n)
+	a.m2 += delta * (f - a.mean)
+}
+func (a *stddevAggregator) Result() interface{} {
+	if a.n < 2 {
+		// A group with fewer than 2 samples is an ordinary shape for
+		// grouped time-series data, not an edge case -- math.NaN() here
+		// used to make json.Marshal of the result fail outright.
+		return 0.0
+	}
+	return math.Sqrt(a.m2 / float64(a.n-1))
+}
+
+// percentileAggregator buffers every value seen for the row and uses the
+// nearest-rank method at Result time.
+type percentileAggregator struct {
+	p      float64
+	values []float64
+}
+
+func (a *percentileAggregator) Add(v interface{}, ts int64) {
+	a.values = append(a.values, toFloat(v))
+}
+func (a *percentileAggregator) Result() interface{} {
+	if len(a.values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64{}, a.values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(a.p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// firstLastAggregator retains the value with the smallest (first=true) or
+// largest (first=false) _ts seen for the group.
+type firstLastAggregator struct {
+	first bool
+	set   bool
+	ts    int64
+	val   interface{}
+}
+
+func (a *firstLastAggregator) Add(v interface{}, ts int64) {
+	if !a.set || (a.first && ts < a.ts) || (!a.first && ts > a.ts) {
+		a.val = v
+		a.ts = ts
+		a.set = true
+	}
+}
+func (a *firstLastAggregator) Result() interface{} { return a.val }
+
+// distinctAggregator backs both "distinct" (sorted unique values) and
+// "count_distinct" (the size of that same set), keyed on each value's JSON
+// encoding so values of different types never collide.
+type distinctAggregator struct {
+	seen      map[string]interface{}
+	countOnly bool
+}
+
+func (a *distinctAggregator) Add(v interface{}, ts int64) {
+	key, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	a.seen[string(key)] = v
+}
+func (a *distinctAggregator) Result() interface{} {
+	if a.countOnly {
+		return float64(len(a.seen))
+	}
+	keys := make([]string, 0, len(a.seen))
+	for k := range a.seen {
+		keys = append(keys, k)
+	}
+	// Numbers sort by value and strings by text; any other pair by JSON encoding.
+	sort.Slice(keys, func(i, j int) bool {
+		vi, vj := a.seen[keys[i]], a.seen[keys[j]]
+		if ni, ok := toNumber(vi); ok {
+			if nj, ok := toNumber(vj); ok {
+				return ni < nj
+			}
+		}
+		if si, ok := vi.(string); ok {
+			if sj, ok := vj.(string); ok {
+				return si < sj
+			}
+		}
+		return keys[i] < keys[j]
+	})
+	values := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, a.seen[k])
+	}
+	return values
+}
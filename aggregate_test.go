@@ -0,0 +1,32 @@
+package eventstore
+
+import "testing"
+
+// TestStddevAggregatorSingleSample guards against a regression to
+// math.NaN(): a GroupBy key with exactly one matching event is an ordinary
+// shape for grouped time-series data, not an edge case, and NaN can't be
+// JSON-marshaled at all.
+func TestStddevAggregatorSingleSample(t *testing.T) {
+	a := &stddevAggregator{}
+	a.Add(42.0, 0)
+
+	result, ok := a.Result().(float64)
+	if !ok {
+		t.Fatalf("expected a float64 result, got %T", a.Result())
+	}
+	if result != 0 {
+		t.Errorf("expected 0 for a single sample, got %v", result)
+	}
+}
+
+func TestStddevAggregatorNoSamples(t *testing.T) {
+	a := &stddevAggregator{}
+
+	result, ok := a.Result().(float64)
+	if !ok {
+		t.Fatalf("expected a float64 result, got %T", a.Result())
+	}
+	if result != 0 {
+		t.Errorf("expected 0 with no samples, got %v", result)
+	}
+}
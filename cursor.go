@@ -0,0 +1,115 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// cursorWalk scans the lm2 collection within desc.TimeRange, applies
+// desc.Filters, computes each event's GroupBy row key, and calls visit once
+// per surviving event with its microsecond timestamp and row key. It's the
+// single cursor loop shared by Query and QueryContext, so the two entry
+// points can't drift on filtering/grouping semantics the way QueryContext's
+// hand-duplicated copy of this loop once did.
+//
+// ctx is checked between events so a long walk can be cancelled; pass
+// context.Background() for an uncancellable walk.
+func (c *EventCollection) cursorWalk(ctx context.Context, desc QueryDesc, visit func(event Event, ts int64, rowKey string) error) error {
+	cur, err := c.lm2Col.NewCursor()
+	if err != nil {
+		return err
+	}
+
+	formattedStartTs := formatTs(toMicrosecondTime(desc.TimeRange.Start))
+	formattedEndTs := formatTs(toMicrosecondTime(desc.TimeRange.End))
+
+	startKey := string(eventKeyPrefix) + string(formattedStartTs[:])
+	endKey := string(eventKeyPrefix) + string(formattedEndTs[:]) + "\xff"
+
+	filterRegexps, err := compileFilters(desc.Filters)
+	if err != nil {
+		return err
+	}
+
+	cur.Seek(startKey)
+
+CursorLoop:
+	for cur.Next() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if cur.Key() > endKey {
+			break
+		}
+
+		if (cur.Key())[0] == '_' {
+			continue
+		}
+
+		id := cur.Key()
+		val := cur.Value()
+		ts, keyTag, hash, err := splitCollectionID(id)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		if ts < toMicrosecondTime(desc.TimeRange.Start) {
+			continue CursorLoop
+		}
+
+		event := Event{}
+		if err := json.Unmarshal([]byte(val), &event); err != nil {
+			log.Println(err)
+			return err
+		}
+
+		eventID := strconv.FormatInt(ts, 10) + "-" + keyTag
+		event["_ts"] = ts
+		event["_tag"] = keyTag
+		if len(hash) > 0 {
+			event["_hash"] = hash
+			eventID += "-" + hash
+		}
+		event["_id"] = eventID
+
+		for i, filter := range desc.Filters {
+			pass, err := applyFilter(filter, filterRegexps[i], event)
+			if err != nil {
+				return err
+			}
+			if !pass {
+				continue CursorLoop
+			}
+		}
+
+		rowKey := ""
+		if len(desc.GroupBy) > 0 {
+			rowKeyParts := []string{}
+			for _, groupCol := range desc.GroupBy {
+				groupColVal := event[groupCol]
+				if groupColVal == nil {
+					continue CursorLoop
+				}
+				marshaledColVal, err := json.Marshal(groupColVal)
+				if err != nil {
+					continue CursorLoop
+				}
+				rowKeyParts = append(rowKeyParts, string(marshaledColVal))
+			}
+			rowKey = strings.Join(rowKeyParts, "\x00")
+		}
+
+		if err := visit(event, ts, rowKey); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
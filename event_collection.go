@@ -8,6 +8,12 @@ import (
 	"github.com/Preetam/lm2"
 )
 
+const (
+	eventKeyPrefix     byte = 'e'
+	versionKeyPrefix   byte = 'v'
+	retentionKeyPrefix byte = 'r'
+)
+
 var (
 	errNotFound = errors.New("not found")
 )
@@ -1,42 +1,17 @@
 package eventstore
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"log"
 	"math"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/Preetam/lm2"
 )
 
-const (
-	eventKeyPrefix   byte = 'e'
-	versionKeyPrefix byte = 'v'
-)
-
-var (
-	errNotFound = errors.New("not found")
-
-	eventIDTagRegexp  = regexp.MustCompile("^[a-zA-Z0-9_./]{1,256}$")
-	eventIDHashRegexp = regexp.MustCompile("^[a-zA-Z0-9]{1,16}$")
-
-	minTimestamp = time.Unix(0, 0)
-)
-
-type Event map[string]interface{}
-
-type CreateEventsRequest struct {
-	Tag     string  `json:"tag"`
-	Version int     `json:"version"`
-	Events  []Event `json:"events"`
-}
-
 type QueryDesc struct {
 	Columns    []ColumnDesc `json:"columns,omitempty"`
 	TimeRange  TimeRange    `json:"time_range"`
@@ -46,6 +21,26 @@ type QueryDesc struct {
 	OrderBy    []string     `json:"order_by,omitempty"`
 	Descending bool         `json:"descending"`
 	Limit      int          `json:"limit,omitempty"`
+	// Fill controls how Query fills time buckets that had no matching
+	// events when PointSize > 0: "none" (default, omit the bucket),
+	// "null", "zero", "previous" or "linear". See fillSeries.
+	Fill string `json:"fill,omitempty"`
+	// LegacyFormat makes Query return a QueryResult, with groups flattened
+	// into Summary/Series Event maps, instead of the default
+	// GroupedQueryResult.
+	LegacyFormat bool `json:"legacy_format,omitempty"`
+}
+
+// QueryResult is Query's result shape when QueryDesc.LegacyFormat is true:
+// groups are flattened into Summary (one Event per GroupBy tuple) and
+// Series (one Event per GroupBy tuple per time bucket, when PointSize > 0),
+// with aggregate and group-by values stored as loosely typed map entries.
+// Prefer GroupedQueryResult, Query's default result shape.
+type QueryResult struct {
+	Summary []Event     `json:"summary,omitempty"`
+	Series  []Event     `json:"series,omitempty"`
+	Events  []Event     `json:"events,omitempty"`
+	Query   interface{} `json:"query"`
 }
 
 type ColumnDesc struct {
@@ -58,17 +53,16 @@ type TimeRange struct {
 	End   time.Time `json:"end"`
 }
 
+// Filter keeps only events where Column satisfies Condition against Value.
+// Condition is one of eq, neq, gt, gte, lt, lte, in, nin, regex, nregex,
+// exists, nexists. in/nin expect Value to be a []interface{}; regex/nregex
+// expect Value to be a pattern string.
 type Filter struct {
 	Column    string      `json:"column"`
 	Condition string      `json:"condition"`
 	Value     interface{} `json:"value"`
 }
 
-type EventCollection struct {
-	lm2Col *lm2.Collection
-	lock   sync.Mutex
-}
-
 type ByTimestamp []Event
 
 func (t ByTimestamp) Len() int      { return len(t) }
@@ -93,307 +87,48 @@ func (o OrderBy) Less(i, j int) bool {
 	return true
 }
 
-func OpenEventCollection(path string) (*EventCollection, error) {
-	col, err := lm2.OpenCollection(path, 10000)
-	if err != nil {
-		return nil, err
-	}
-
-	return &EventCollection{
-		lm2Col: col,
-	}, nil
-}
-
-func CreateEventCollection(path string) (*EventCollection, error) {
-	col, err := lm2.NewCollection(path, 10000)
-	if err != nil {
-		return nil, err
-	}
-
-	return &EventCollection{
-		lm2Col: col,
-	}, nil
-}
-
-func (c *EventCollection) Version(tag string) (int, error) {
-	cur, err := c.lm2Col.NewCursor()
-	if err != nil {
-		return 0, err
-	}
-
-	versionStr, err := cursorGet(cur, string(versionKeyPrefix)+"-"+tag)
-	if err != nil {
-		return 0, err
-	}
-
-	return strconv.Atoi(versionStr)
-}
-
-func (c *EventCollection) StoreEvents(req CreateEventsRequest) (int, error) {
-	// Validate tag
-	if !eventIDTagRegexp.MatchString(req.Tag) {
-		log.Println(req.Tag)
-		return 0, errors.New("invalid tag")
-	}
-
-	events := req.Events
-
-	wb := lm2.NewWriteBatch()
-	for _, event := range events {
-		delete(event, "_id")
-
-		marshalled, err := json.Marshal(event)
-		if err != nil {
-			return 0, err
-		}
-
-		var ts int64
-		if tsVal, ok := event["_ts"]; ok {
-			if tsString, ok := tsVal.(string); ok {
-				timeTs, err := time.Parse(time.RFC3339Nano, tsString)
-				if err != nil {
-					return 0, errors.New("ts is not formatted per RFC 3339")
-				}
-				if timeTs.Before(minTimestamp) {
-					return 0, errors.New("ts before Unix epoch")
-				}
-				ts = toMicrosecondTime(timeTs)
-			} else {
-				return 0, errors.New("ts is not a string")
-			}
-		} else {
-			return 0, errors.New("missing event ts")
-		}
-
-		hash := ""
-		if hashValue, ok := event["_hash"]; ok {
-			if hashString, ok := hashValue.(string); ok {
-				hash = hashString
-			}
-		}
-
-		formattedTs := formatTs(ts)
-		idStr := string(eventKeyPrefix) + string(formattedTs[:]) + "-" + req.Tag + "-" + hash
-		wb.Set(idStr, string(marshalled))
-	}
-
-	version, err := c.Version(req.Tag)
-	if err != nil {
-		if err == errNotFound {
-			version = 0
-		} else {
-			return 0, errors.New("error getting tag version")
-		}
-	}
-
-	version++
-	wb.Set(string(versionKeyPrefix)+"-"+req.Tag, strconv.Itoa(version))
-
-	_, err = c.lm2Col.Update(wb)
-	if err != nil {
-		return 0, err
-	}
-
-	return version, nil
-}
-
 func (c *EventCollection) Query(desc QueryDesc) (interface{}, error) {
 	if desc.TimeRange.Start == minTimestamp && desc.TimeRange.End == minTimestamp {
 		desc.TimeRange.End = fromMicrosecondTime(math.MaxInt64)
 	}
 
-	cur, err := c.lm2Col.NewCursor()
-	if err != nil {
-		return nil, err
-	}
-
-	formattedStartTs := formatTs(toMicrosecondTime(desc.TimeRange.Start))
-	formattedEndTs := formatTs(toMicrosecondTime(desc.TimeRange.End))
-
-	startKey := string(eventKeyPrefix) + string(formattedStartTs[:])
-	endKey := string(eventKeyPrefix) + string(formattedEndTs[:]) + "\xff"
+	aggregating := len(desc.GroupBy) > 0 || len(desc.Columns) > 0 || desc.PointSize > 0
 
-	summaryRows := map[string][]float64{}
-	summaryRowsByTime := map[int64]map[string][]float64{}
+	summaryRows := map[string][]aggregatorState{}
+	summaryRowsByTime := map[int64]map[string][]aggregatorState{}
 	resultEvents := []Event{}
 
-	cur.Seek(startKey)
-
-CursorLoop:
-	for cur.Next() {
-		if cur.Key() > endKey {
-			break
-		}
-
-		if (cur.Key())[0] == '_' {
-			continue
-		}
-
-		// Extract event
-		id := cur.Key()
-		val := cur.Value()
-		ts, keyTag, hash, err := splitCollectionID(id)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-
-		if ts < toMicrosecondTime(desc.TimeRange.Start) {
-			continue CursorLoop
-		}
-
-		event := Event{}
-		valBytes := []byte(val)
-		err = json.Unmarshal(valBytes, &event)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-
-		eventID := strconv.FormatInt(ts, 10) + "-" + keyTag
-		event["_ts"] = ts
-		event["_tag"] = keyTag
-		if len(hash) > 0 {
-			event["_hash"] = hash
-			eventID += "-" + hash
-		}
-		event["_id"] = eventID
-
-		// Apply filters
-		for _, filter := range desc.Filters {
-			if colValue, ok := event[filter.Column]; ok {
-				filterResult := false
-				switch filter.Condition {
-				case "eq":
-					filterResult = checkEquals(colValue, filter.Value)
-				case "neq":
-					filterResult = !checkEquals(colValue, filter.Value)
-				default:
-					return nil, errors.New("invalid filter condition")
-				}
-
-				if !filterResult {
-					continue CursorLoop
-				}
-			} else {
-				continue CursorLoop
-			}
-		}
-
-		if len(desc.GroupBy) == 0 && len(desc.Columns) == 0 && desc.PointSize <= 0 {
-			// No group by or aggregates
+	err := c.cursorWalk(context.Background(), desc, func(event Event, ts int64, rowKey string) error {
+		if !aggregating {
 			event["_ts"] = fromMicrosecondTime(ts)
 			resultEvents = append(resultEvents, event)
-			continue
-		}
-
-		// Figure out the row key for grouping
-		rowKey := ""
-		if len(desc.GroupBy) > 0 {
-			rowKeyParts := []string{}
-			for _, groupCol := range desc.GroupBy {
-				groupColVal := event[groupCol]
-				if groupColVal == nil {
-					continue CursorLoop
-				}
-				marshaledColVal, err := json.Marshal(groupColVal)
-				if err != nil {
-					continue CursorLoop
-				}
-				rowKeyParts = append(rowKeyParts, string(marshaledColVal))
-			}
-			rowKey = strings.Join(rowKeyParts, "\x00")
-		}
-
-		// Do the aggregations.
-
-		updateRows := func(rowKey string, rows map[string][]float64) {
-			rowAggregates, ok := rows[rowKey]
-			if !ok {
-				rowAggregates = make([]float64, len(desc.Columns))
-				for i := range rowAggregates {
-					rowAggregates[i] = math.NaN()
-				}
-			}
-
-			for i, columnDesc := range desc.Columns {
-				floatVal := 0.0
-				columnVal := event[columnDesc.Name]
-				switch columnVal.(type) {
-				case int:
-					floatVal = float64(columnVal.(int))
-				case float64:
-					floatVal = columnVal.(float64)
-				}
-				switch columnDesc.Aggregate {
-				case "sum":
-					if math.IsNaN(rowAggregates[i]) {
-						rowAggregates[i] = 0
-					}
-					rowAggregates[i] += floatVal
-				case "count":
-					if math.IsNaN(rowAggregates[i]) {
-						rowAggregates[i] = 0
-					}
-					rowAggregates[i] += 1
-				case "min":
-					if rowAggregates[i] > floatVal || math.IsNaN(rowAggregates[i]) {
-						rowAggregates[i] = floatVal
-					}
-				case "max":
-					if rowAggregates[i] < floatVal || math.IsNaN(rowAggregates[i]) {
-						rowAggregates[i] = floatVal
-					}
-				}
-			}
-
-			rows[rowKey] = rowAggregates
+			return nil
 		}
 
 		if len(desc.Columns) > 0 {
-			updateRows(rowKey, summaryRows)
+			if err := updateAggregateRow(desc, event, ts, rowKey, summaryRows); err != nil {
+				return err
+			}
 		}
 
 		if desc.PointSize > 0 {
 			timeGroup := ts / desc.PointSize
-			var rows map[string][]float64
-			var ok bool
-			if rows, ok = summaryRowsByTime[timeGroup]; !ok {
-				rows = map[string][]float64{}
+			rows, ok := summaryRowsByTime[timeGroup]
+			if !ok {
+				rows = map[string][]aggregatorState{}
 				summaryRowsByTime[timeGroup] = rows
 			}
-			updateRows(rowKey, rows)
+			if err := updateAggregateRow(desc, event, ts, rowKey, rows); err != nil {
+				return err
+			}
 		}
-	} // Event cursor loop
-
-	if err = cur.Err(); err != nil {
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	summaryEvents := []Event{}
-	for rowKey, rowAggregates := range summaryRows {
-		event := Event{}
-		if len(desc.GroupBy) > 0 {
-			parts := strings.Split(rowKey, "\x00")
-			for i, part := range parts {
-				if desc.GroupBy[i] == "_ts" {
-					ts, _ := strconv.Atoi(part)
-					event["_ts"] = fromMicrosecondTime(int64(ts))
-					continue
-				}
-				var val interface{}
-				dec := json.NewDecoder(strings.NewReader(part))
-				dec.UseNumber()
-				dec.Decode(&val)
-				event[desc.GroupBy[i]] = val
-			}
-		}
-		for i, columnDesc := range desc.Columns {
-			fieldName := columnDesc.Aggregate + "(" + columnDesc.Name + ")"
-			event[fieldName] = rowAggregates[i]
-		}
-		summaryEvents = append(summaryEvents, event)
-	}
+	summaryEvents := rowsToEvents(desc, summaryRows)
 
 	if len(desc.OrderBy) != 0 {
 		var ordering sort.Interface = OrderBy{
@@ -412,43 +147,29 @@ CursorLoop:
 
 	seriesEvents := []Event{}
 	if desc.PointSize > 0 {
-		for ts, rows := range summaryRowsByTime {
-			for rowKey, rowAggregates := range rows {
-				event := Event{
-					"_ts": fromMicrosecondTime(ts * desc.PointSize),
-				}
-				if len(desc.GroupBy) > 0 {
-					parts := strings.Split(rowKey, "\x00")
-					for i, part := range parts {
-						if desc.GroupBy[i] == "_ts" {
-							continue
-						}
-						var val interface{}
-						dec := json.NewDecoder(strings.NewReader(part))
-						dec.UseNumber()
-						dec.Decode(&val)
-						event[desc.GroupBy[i]] = val
-					}
-				}
-				for i, columnDesc := range desc.Columns {
-					fieldName := columnDesc.Aggregate + "(" + columnDesc.Name + ")"
-					event[fieldName] = rowAggregates[i]
-				}
-				seriesEvents = append(seriesEvents, event)
+		seriesEvents = seriesRowsToEvents(desc, summaryRowsByTime)
+		seriesEvents = fillSeries(desc, seriesEvents)
+
+		sort.Slice(seriesEvents, func(i, j int) bool {
+			ti := seriesEvents[i]["_ts"].(time.Time)
+			tj := seriesEvents[j]["_ts"].(time.Time)
+			if !ti.Equal(tj) {
+				return ti.Before(tj)
 			}
-		}
+			return seriesRowKey(desc, seriesEvents[i]) < seriesRowKey(desc, seriesEvents[j])
+		})
+	}
 
-		sort.Sort(ByTimestamp(seriesEvents))
+	if desc.LegacyFormat {
+		return QueryResult{Summary: summaryEvents, Series: seriesEvents, Events: resultEvents, Query: desc}, nil
 	}
 
-	type QueryResult struct {
-		Summary []Event     `json:"summary,omitempty"`
-		Series  []Event     `json:"series,omitempty"`
-		Events  []Event     `json:"events,omitempty"`
-		Query   interface{} `json:"query"`
+	groupRows := summaryEvents
+	if desc.PointSize > 0 {
+		groupRows = seriesEvents
 	}
 
-	return QueryResult{Summary: summaryEvents, Series: seriesEvents, Events: resultEvents, Query: desc}, nil
+	return GroupedQueryResult{Groups: buildGroups(desc, groupRows), Events: resultEvents, Query: desc}, nil
 }
 
 func cursorGet(cur *lm2.Cursor, key string) (string, error) {
@@ -553,55 +274,6 @@ func parseFilter(filter string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
-func checkEquals(a, b interface{}) bool {
-	return compareInterfaces(a, b) == 0
-}
-
-func compareInterfaces(a, b interface{}) int {
-	switch a.(type) {
-	case int:
-		aInt := a.(int)
-		if bInt, ok := b.(int); ok {
-			return aInt - bInt
-		}
-	case float64:
-		aFloat := a.(float64)
-		if bFloat, ok := b.(float64); ok {
-			if aFloat == bFloat {
-				return 0
-			} else if aFloat < bFloat {
-				return -1
-			} else {
-				return 1
-			}
-		}
-	case string:
-		aString := a.(string)
-		if bString, ok := b.(string); ok {
-			if aString == bString {
-				return 0
-			} else if aString < bString {
-				return -1
-			} else {
-				return 1
-			}
-		}
-	case json.Number:
-		aFloat, _ := strconv.ParseFloat(string(a.(json.Number)), 64)
-		if bNumber, ok := b.(json.Number); ok {
-			bFloat, _ := strconv.ParseFloat(string(bNumber), 64)
-			if aFloat == bFloat {
-				return 0
-			} else if aFloat < bFloat {
-				return -1
-			} else {
-				return 1
-			}
-		}
-	}
-	return -1
-}
-
 func formatTs(ts int64) [8]byte {
 	b := [8]byte{
 		byte(ts >> (8 * 7)),
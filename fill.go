@@ -0,0 +1,177 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// fillSeries backfills missing (bucket, group) points in seriesEvents
+// according to desc.Fill. Without it, Query only emits a point for buckets
+// that actually had matching events, which makes for a ragged or misleading
+// chart whenever a bucket in the time range had no data.
+func fillSeries(desc QueryDesc, seriesEvents []Event) []Event {
+	if desc.PointSize <= 0 || desc.Fill == "" || desc.Fill == "none" {
+		return seriesEvents
+	}
+
+	startBucket := toMicrosecondTime(desc.TimeRange.Start) / desc.PointSize
+	endBucket := toMicrosecondTime(desc.TimeRange.End) / desc.PointSize
+	if endBucket < startBucket {
+		return seriesEvents
+	}
+
+	fieldNames := make([]string, len(desc.Columns))
+	for i, col := range desc.Columns {
+		fieldNames[i] = col.Aggregate + "(" + col.Name + ")"
+	}
+
+	byGroup := map[string][]seriesPoint{}
+	template := map[string]Event{}
+	for _, event := range seriesEvents {
+		bucket := toMicrosecondTime(event["_ts"].(time.Time)) / desc.PointSize
+		key := seriesRowKey(desc, event)
+		byGroup[key] = append(byGroup[key], seriesPoint{bucket: bucket, event: event})
+		if _, ok := template[key]; !ok {
+			template[key] = event
+		}
+	}
+
+	// With no events at all there are no group-by values to backfill a
+	// synthetic point with, so there's nothing sensible to fill.
+	if len(byGroup) == 0 {
+		return seriesEvents
+	}
+
+	newEvent := func(key string, bucket int64) Event {
+		event := Event{"_ts": fromMicrosecondTime(bucket * desc.PointSize)}
+		for _, col := range desc.GroupBy {
+			if col == "_ts" {
+				continue
+			}
+			if v, ok := template[key][col]; ok {
+				event[col] = v
+			}
+		}
+		return event
+	}
+
+	result := make([]Event, 0, len(seriesEvents))
+	for key, points := range byGroup {
+		sort.Slice(points, func(i, j int) bool { return points[i].bucket < points[j].bucket })
+
+		present := map[int64]Event{}
+		for _, pt := range points {
+			present[pt.bucket] = pt.event
+		}
+
+		for bucket := startBucket; bucket <= endBucket; bucket++ {
+			if event, ok := present[bucket]; ok {
+				result = append(result, event)
+				continue
+			}
+
+			event := newEvent(key, bucket)
+			switch desc.Fill {
+			case "null":
+				for _, name := range fieldNames {
+					event[name] = nil
+				}
+			case "zero":
+				for _, col := range desc.Columns {
+					name := col.Aggregate + "(" + col.Name + ")"
+					event[name] = zeroValueForAggregate(col.Aggregate)
+				}
+			case "previous":
+				if prev, ok := lastPointBefore(points, bucket); ok {
+					for _, name := range fieldNames {
+						event[name] = prev.event[name]
+					}
+				} else {
+					for _, name := range fieldNames {
+						event[name] = nil
+					}
+				}
+			case "linear":
+				prev, hasPrev := lastPointBefore(points, bucket)
+				next, hasNext := firstPointAfter(points, bucket)
+				for _, name := range fieldNames {
+					if hasPrev && hasNext && next.bucket != prev.bucket {
+						if pv, pok := toNumber(prev.event[name]); pok {
+							if nv, nok := toNumber(next.event[name]); nok {
+								frac := float64(bucket-prev.bucket) / float64(next.bucket-prev.bucket)
+								event[name] = pv + (nv-pv)*frac
+								continue
+							}
+						}
+					}
+					event[name] = nil
+				}
+			}
+			result = append(result, event)
+		}
+	}
+
+	return result
+}
+
+// zeroValueForAggregate returns the "zero" fill value for an aggregate, so
+// fillSeries doesn't hardcode a bare 0.0 onto aggregates whose Result() isn't
+// numeric -- distinct's zero is an empty set, and first/last have no
+// sensible zero since the underlying column can be any type.
+func zeroValueForAggregate(aggregate string) interface{} {
+	switch aggregate {
+	case "distinct":
+		return []interface{}{}
+	case "first", "last":
+		return nil
+	default:
+		return 0.0
+	}
+}
+
+// seriesPoint is one known (non-missing) point in a fillSeries group,
+// ordered by the time bucket it falls in.
+type seriesPoint struct {
+	bucket int64
+	event  Event
+}
+
+func lastPointBefore(points []seriesPoint, bucket int64) (seriesPoint, bool) {
+	var best seriesPoint
+	found := false
+	for _, pt := range points {
+		if pt.bucket < bucket && (!found || pt.bucket > best.bucket) {
+			best = pt
+			found = true
+		}
+	}
+	return best, found
+}
+
+func firstPointAfter(points []seriesPoint, bucket int64) (seriesPoint, bool) {
+	var best seriesPoint
+	found := false
+	for _, pt := range points {
+		if pt.bucket > bucket && (!found || pt.bucket < best.bucket) {
+			best = pt
+			found = true
+		}
+	}
+	return best, found
+}
+
+// seriesRowKey builds a stable key for a series event's non-time GroupBy
+// values, so fillSeries can bucket points by group and the final sort can
+// break _ts ties deterministically.
+func seriesRowKey(desc QueryDesc, event Event) string {
+	key := ""
+	for _, col := range desc.GroupBy {
+		if col == "_ts" {
+			continue
+		}
+		marshaled, _ := json.Marshal(event[col])
+		key += col + "=" + string(marshaled) + "\x00"
+	}
+	return key
+}
@@ -0,0 +1,162 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// compileFilters precompiles any regex/nregex filter patterns once, outside
+// the cursor loop, so a scan only pays for a cached *regexp.Regexp.MatchString
+// per event instead of recompiling the pattern on every row. The returned
+// slice is parallel to filters; entries for non-regex conditions are nil.
+func compileFilters(filters []Filter) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(filters))
+	for i, filter := range filters {
+		if filter.Condition != "regex" && filter.Condition != "nregex" {
+			continue
+		}
+		pattern, ok := filter.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s filter value must be a string", filter.Condition)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// applyFilter reports whether event satisfies filter. re must be the
+// compiled regexp returned by compileFilters for "regex"/"nregex"
+// conditions, and is ignored otherwise.
+func applyFilter(filter Filter, re *regexp.Regexp, event Event) (bool, error) {
+	colValue, ok := event[filter.Column]
+
+	switch filter.Condition {
+	case "exists":
+		return ok, nil
+	case "nexists":
+		return !ok, nil
+	}
+
+	if !ok {
+		return false, nil
+	}
+
+	switch filter.Condition {
+	case "eq":
+		return checkEquals(colValue, filter.Value), nil
+	case "neq":
+		return !checkEquals(colValue, filter.Value), nil
+	case "gt":
+		return compareInterfaces(colValue, filter.Value) > 0, nil
+	case "gte":
+		return compareInterfaces(colValue, filter.Value) >= 0, nil
+	case "lt":
+		return compareInterfaces(colValue, filter.Value) < 0, nil
+	case "lte":
+		return compareInterfaces(colValue, filter.Value) <= 0, nil
+	case "in":
+		return valueIn(colValue, filter.Value), nil
+	case "nin":
+		return !valueIn(colValue, filter.Value), nil
+	case "regex":
+		return re.MatchString(fmt.Sprint(colValue)), nil
+	case "nregex":
+		return !re.MatchString(fmt.Sprint(colValue)), nil
+	}
+
+	return false, fmt.Errorf("invalid filter condition %q", filter.Condition)
+}
+
+func valueIn(v interface{}, list interface{}) bool {
+	values, ok := list.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range values {
+		if checkEquals(v, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkEquals(a, b interface{}) bool {
+	return compareInterfaces(a, b) == 0
+}
+
+// compareInterfaces orders a relative to b: -1 if a < b, 0 if equal, 1 if
+// a > b. int, float64 and json.Number are coerced to float64 so numeric
+// filter values decoded from JSON compare correctly against event values of
+// any of those three types. bool orders false < true. Any other type, or a
+// type mismatch between a and b, falls back to reflect.DeepEqual so eq/neq
+// still work correctly; it reports unequal as -1 since there's no
+// meaningful ordering.
+func compareInterfaces(a, b interface{}) int {
+	if aNum, ok := toNumber(a); ok {
+		if bNum, ok := toNumber(b); ok {
+			switch {
+			case aNum == bNum:
+				return 0
+			case aNum < bNum:
+				return -1
+			default:
+				return 1
+			}
+		}
+		return -1
+	}
+
+	if aStr, ok := a.(string); ok {
+		if bStr, ok := b.(string); ok {
+			switch {
+			case aStr == bStr:
+				return 0
+			case aStr < bStr:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+
+	if aBool, ok := a.(bool); ok {
+		if bBool, ok := b.(bool); ok {
+			switch {
+			case aBool == bBool:
+				return 0
+			case !aBool && bBool:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+
+	return -1
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	}
+	return 0, false
+}
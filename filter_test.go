@@ -0,0 +1,36 @@
+package eventstore
+
+import "testing"
+
+func TestCheckEqualsBool(t *testing.T) {
+	if !checkEquals(true, true) {
+		t.Error("checkEquals(true, true) should be true")
+	}
+	if !checkEquals(false, false) {
+		t.Error("checkEquals(false, false) should be true")
+	}
+	if checkEquals(true, false) {
+		t.Error("checkEquals(true, false) should be false")
+	}
+}
+
+func TestCompareInterfacesBoolOrdering(t *testing.T) {
+	if compareInterfaces(false, true) >= 0 {
+		t.Error("expected false < true")
+	}
+	if compareInterfaces(true, false) <= 0 {
+		t.Error("expected true > false")
+	}
+}
+
+func TestCheckEqualsUnhandledTypeFallback(t *testing.T) {
+	a := []interface{}{"x", "y"}
+	b := []interface{}{"x", "y"}
+	if !checkEquals(a, b) {
+		t.Error("checkEquals should treat deeply equal slices as equal")
+	}
+
+	if checkEquals(a, []interface{}{"x", "z"}) {
+		t.Error("checkEquals should treat different slices as unequal")
+	}
+}
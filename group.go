@@ -0,0 +1,230 @@
+package eventstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedValue wraps a single result value with an explicit Kind, so its JSON
+// encoding is stable no matter which Go type produced it. Without this,
+// aggregate results arrive as a mix of float64, json.Number and plain ints,
+// and encoding/json renders a whole-number float64 indistinguishably from
+// an int, silently losing the distinction a caller needs to parse the
+// value back correctly.
+type TypedValue struct {
+	Kind  string      `json:"-"`
+	Value interface{} `json:"-"`
+}
+
+// Kinds a TypedValue can carry.
+const (
+	KindInt    = "int"
+	KindFloat  = "float"
+	KindString = "string"
+	KindBool   = "bool"
+	KindNull   = "null"
+	KindArray  = "array"
+)
+
+// newTypedValue classifies v, as produced by Query's aggregation and
+// grouping paths, into a TypedValue.
+func newTypedValue(v interface{}) TypedValue {
+	switch val := v.(type) {
+	case nil:
+		return TypedValue{Kind: KindNull}
+	case bool:
+		return TypedValue{Kind: KindBool, Value: val}
+	case int:
+		return TypedValue{Kind: KindInt, Value: int64(val)}
+	case int64:
+		return TypedValue{Kind: KindInt, Value: val}
+	case float64:
+		return TypedValue{Kind: KindFloat, Value: val}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return TypedValue{Kind: KindInt, Value: i}
+		}
+		f, _ := val.Float64()
+		return TypedValue{Kind: KindFloat, Value: f}
+	case string:
+		return TypedValue{Kind: KindString, Value: val}
+	case []interface{}:
+		return TypedValue{Kind: KindArray, Value: val}
+	default:
+		return TypedValue{Kind: KindString, Value: fmt.Sprintf("%v", val)}
+	}
+}
+
+// MarshalJSON renders v as a plain JSON value -- a number, string, bool,
+// null or array -- but pins the formatting per Kind so an int and a float
+// that happen to share a value don't collapse onto the same wire shape
+// (5 vs. 5.0).
+func (v TypedValue) MarshalJSON() ([]byte, error) {
+	switch v.Kind {
+	case KindNull, "":
+		return []byte("null"), nil
+	case KindInt:
+		return json.Marshal(v.Value)
+	case KindFloat:
+		f, _ := v.Value.(float64)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			// encoding/json can't represent NaN/Inf at all; whatever
+			// produced this value (an aggregator's Result, say) should
+			// avoid them too, but this is the last line of defense before
+			// the bytes hit the wire.
+			return []byte("null"), nil
+		}
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return []byte(s), nil
+	case KindString, KindBool, KindArray:
+		return json.Marshal(v.Value)
+	default:
+		return nil, fmt.Errorf("eventstore: typed value has unknown kind %q", v.Kind)
+	}
+}
+
+// UnmarshalJSON infers a Kind from the shape of data, so a TypedValue can
+// round-trip a plain JSON value without the wire format carrying Kind
+// explicitly.
+func (v *TypedValue) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0 || string(trimmed) == "null":
+		*v = TypedValue{Kind: KindNull}
+		return nil
+	case trimmed[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*v = TypedValue{Kind: KindString, Value: s}
+		return nil
+	case trimmed[0] == '[':
+		var arr []interface{}
+		if err := json.Unmarshal(data, &arr); err != nil {
+			return err
+		}
+		*v = TypedValue{Kind: KindArray, Value: arr}
+		return nil
+	case string(trimmed) == "true" || string(trimmed) == "false":
+		*v = TypedValue{Kind: KindBool, Value: string(trimmed) == "true"}
+		return nil
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var num json.Number
+		if err := dec.Decode(&num); err != nil {
+			return err
+		}
+		if i, err := num.Int64(); err == nil && !strings.ContainsAny(num.String(), ".eE") {
+			*v = TypedValue{Kind: KindInt, Value: i}
+			return nil
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return err
+		}
+		*v = TypedValue{Kind: KindFloat, Value: f}
+		return nil
+	}
+}
+
+// Row is a single aggregated point within a Group.
+type Row struct {
+	Timestamp time.Time             `json:"timestamp"`
+	Values    map[string]TypedValue `json:"values"`
+}
+
+// Group is one GroupBy partition of a Query result. PartitionKey holds the
+// non-"_ts" GroupBy column values shared by every Row in Rows.
+type Group struct {
+	PartitionKey map[string]interface{} `json:"partition_key,omitempty"`
+	Rows         []Row                  `json:"rows"`
+}
+
+// GroupedQueryResult is Query's default result shape: one Group per
+// distinct GroupBy tuple, with typed Rows instead of loosely typed Event
+// maps. Events holds raw (ungrouped, unaggregated) matches, same as
+// QueryResult.Events. Set QueryDesc.LegacyFormat to get a QueryResult
+// instead.
+type GroupedQueryResult struct {
+	Groups []Group     `json:"groups,omitempty"`
+	Events []Event     `json:"events,omitempty"`
+	Query  interface{} `json:"query"`
+}
+
+// buildGroups partitions rows (summaryEvents when desc.PointSize <= 0,
+// seriesEvents otherwise) by their non-"_ts" GroupBy values. Each row
+// becomes one Row in its Group, timestamped from "_ts" if present or
+// desc.TimeRange.End otherwise; a Group's Rows are sorted by Timestamp
+// when desc.PointSize > 0.
+func buildGroups(desc QueryDesc, rows []Event) []Group {
+	type groupEntry struct {
+		partitionKey map[string]interface{}
+		rows         []Row
+	}
+
+	entries := map[string]*groupEntry{}
+	keys := []string{}
+
+	for _, event := range rows {
+		partitionKey := map[string]interface{}{}
+		for _, col := range desc.GroupBy {
+			if col == "_ts" {
+				continue
+			}
+			if v, ok := event[col]; ok {
+				partitionKey[col] = v
+			}
+		}
+
+		marshaledKey, _ := json.Marshal(partitionKey)
+		key := string(marshaledKey)
+
+		entry, ok := entries[key]
+		if !ok {
+			entry = &groupEntry{partitionKey: partitionKey}
+			entries[key] = entry
+			keys = append(keys, key)
+		}
+
+		values := map[string]TypedValue{}
+		for _, col := range desc.Columns {
+			fieldName := col.Aggregate + "(" + col.Name + ")"
+			if v, ok := event[fieldName]; ok {
+				values[fieldName] = newTypedValue(v)
+			}
+		}
+
+		timestamp := desc.TimeRange.End
+		if ts, ok := event["_ts"].(time.Time); ok {
+			timestamp = ts
+		}
+
+		entry.rows = append(entry.rows, Row{Timestamp: timestamp, Values: values})
+	}
+
+	sort.Strings(keys)
+
+	groups := make([]Group, 0, len(entries))
+	for _, key := range keys {
+		entry := entries[key]
+		if desc.PointSize > 0 {
+			sort.Slice(entry.rows, func(i, j int) bool {
+				return entry.rows[i].Timestamp.Before(entry.rows[j].Timestamp)
+			})
+		}
+		groups = append(groups, Group{PartitionKey: entry.partitionKey, Rows: entry.rows})
+	}
+
+	return groups
+}
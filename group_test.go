@@ -0,0 +1,46 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestTypedValueMarshalJSONNonFiniteFloat guards MarshalJSON as the last
+// line of defense before serialization: encoding/json can't represent
+// NaN/Inf at all, and strconv.FormatFloat on NaN produces the literal bytes
+// "NaN.0", which isn't valid JSON either.
+func TestTypedValueMarshalJSONNonFiniteFloat(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		v := TypedValue{Kind: KindFloat, Value: f}
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", f, err)
+		}
+		if string(data) != "null" {
+			t.Errorf("Marshal(%v) = %s, want null", f, data)
+		}
+	}
+}
+
+// TestGroupedQueryResultMarshalsWithSparseGroup checks that a
+// GroupedQueryResult whose single Row holds a NaN aggregate value still
+// marshals, since TypedValue.MarshalJSON renders the NaN as null.
+func TestGroupedQueryResultMarshalsWithSparseGroup(t *testing.T) {
+	result := GroupedQueryResult{
+		Groups: []Group{
+			{
+				PartitionKey: map[string]interface{}{"host": "a"},
+				Rows: []Row{{
+					Values: map[string]TypedValue{
+						"stddev(latency)": newTypedValue(math.NaN()),
+					},
+				}},
+			},
+		},
+	}
+
+	if _, err := json.Marshal(result); err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+}
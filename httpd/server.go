@@ -0,0 +1,239 @@
+// Package httpd wraps an eventstore.EventCollection in an HTTP API, keeping
+// transport concerns (routing, auth, streaming) out of the core package.
+package httpd
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Preetam/eventstore"
+	"github.com/Preetam/eventstore/parser"
+)
+
+// Authorizer gates access to tag for a request. It's called once per
+// request with the tag the request reads or writes, so a multi-tenant
+// deployment can reject the request before it reaches the collection. A
+// query with no resolvable _tag eq filter is rejected before authorize is
+// even called, so it's never invoked with tag == "". A nil error allows the
+// request.
+type Authorizer func(r *http.Request, tag string) error
+
+type server struct {
+	col       *eventstore.EventCollection
+	authorize Authorizer
+}
+
+// NewServer returns an http.Handler exposing col's StoreEvents/Query/Version
+// API over HTTP:
+//
+//	POST /events        body is a CreateEventsRequest, responds with the new version
+//	POST /query         body is a QueryDesc, responds with the Query result
+//	GET  /query?q=...   parses q with the parser package, responds with the Query result
+//	GET  /version/{tag} responds with the tag's current version
+//	GET  /events/stream like GET /query but streams newline-delimited JSON via QueryContext
+//
+// authorize may be nil, in which case every request is allowed.
+func NewServer(col *eventstore.EventCollection, authorize Authorizer) http.Handler {
+	if authorize == nil {
+		authorize = func(*http.Request, string) error { return nil }
+	}
+
+	s := &server{col: col, authorize: authorize}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/events/stream", s.handleEventsStream)
+	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/version/", s.handleVersion)
+	return mux
+}
+
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req eventstore.CreateEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r, req.Tag); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	version, err := s.col.StoreEvents(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]int{"version": version})
+}
+
+func (s *server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	desc, ok := s.parseQueryDesc(w, r)
+	if !ok {
+		return
+	}
+
+	tag := queryTag(desc)
+	if tag == "" {
+		http.Error(w, "query must filter on a single tag", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r, tag); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	result, err := s.col.Query(desc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+func (s *server) handleEventsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	desc, err := parser.Parse(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag := queryTag(desc)
+	if tag == "" {
+		http.Error(w, "query must filter on a single tag", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r, tag); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	chunkSize := 1000
+	if v := r.URL.Query().Get("chunk_size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			chunkSize = n
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	out := make(chan eventstore.QueryChunk)
+	queryErr := make(chan error, 1)
+	go func() {
+		queryErr <- s.col.QueryContext(r.Context(), desc, chunkSize, out)
+	}()
+
+	enc := json.NewEncoder(w)
+	for chunk := range out {
+		for _, events := range [][]eventstore.Event{chunk.Events, chunk.Summary, chunk.Series} {
+			for _, event := range events {
+				if err := enc.Encode(event); err != nil {
+					log.Println(err)
+					return
+				}
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := <-queryErr; err != nil {
+		log.Println(err)
+	}
+}
+
+func (s *server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tag := strings.TrimPrefix(r.URL.Path, "/version/")
+	if tag == "" {
+		http.Error(w, "missing tag", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authorize(r, tag); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	version, err := s.col.Version(tag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]int{"version": version})
+}
+
+// parseQueryDesc reads a QueryDesc from a POST body or, for a GET, from the
+// "q" query parameter via the parser package. It writes an error response
+// and returns ok=false on failure.
+func (s *server) parseQueryDesc(w http.ResponseWriter, r *http.Request) (eventstore.QueryDesc, bool) {
+	switch r.Method {
+	case http.MethodGet:
+		desc, err := parser.Parse(r.URL.Query().Get("q"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return eventstore.QueryDesc{}, false
+		}
+		return desc, true
+	case http.MethodPost:
+		var desc eventstore.QueryDesc
+		if err := json.NewDecoder(r.Body).Decode(&desc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return eventstore.QueryDesc{}, false
+		}
+		return desc, true
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return eventstore.QueryDesc{}, false
+	}
+}
+
+// queryTag returns the tag a QueryDesc targets via an "_tag" eq filter (the
+// shape the parser package produces for FROM tag), or "" if it doesn't
+// filter on a single tag.
+func queryTag(desc eventstore.QueryDesc) string {
+	for _, filter := range desc.Filters {
+		if filter.Column == "_tag" && filter.Condition == "eq" {
+			if tag, ok := filter.Value.(string); ok {
+				return tag
+			}
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		// The response's status/headers are already written by the time
+		// Encode can fail (e.g. a NaN that slipped past TypedValue's
+		// MarshalJSON guard), so there's nothing left to do but surface
+		// it server-side instead of leaving a truncated 200 OK silent.
+		log.Println(err)
+	}
+}
@@ -0,0 +1,102 @@
+package httpd
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Preetam/eventstore"
+)
+
+func TestHandleQueryRejectsUnscopedQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := eventstore.CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := col.StoreEvents(eventstore.CreateEventsRequest{
+		Tag: "secret",
+		Events: []eventstore.Event{
+			{"_ts": "2024-01-01T00:00:00Z", "value": 1.0},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Allows only tag "public" -- "secret" must never be readable through
+	// this authorizer, including via a query that doesn't name a tag.
+	authorize := func(r *http.Request, tag string) error {
+		if tag == "public" {
+			return nil
+		}
+		return errors.New("forbidden")
+	}
+
+	srv := NewServer(col, authorize)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{}"))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unscoped query, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleQueryAuthorizesResolvedTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := eventstore.CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := col.StoreEvents(eventstore.CreateEventsRequest{
+		Tag: "secret",
+		Events: []eventstore.Event{
+			{"_ts": "2024-01-01T00:00:00Z", "value": 1.0},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(r *http.Request, tag string) error {
+		if tag == "public" {
+			return nil
+		}
+		return errors.New("forbidden")
+	}
+
+	srv := NewServer(col, authorize)
+
+	body := `{"filters":[{"column":"_tag","condition":"eq","value":"secret"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a query scoped to an unauthorized tag, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestWriteJSONLogsEncodeFailure guards against an Encode error getting
+// swallowed silently: the response status/headers are already written by
+// the time Encode can fail, so logging is all that's left to surface it.
+func TestWriteJSONLogsEncodeFailure(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	rec := httptest.NewRecorder()
+	writeJSON(rec, map[string]interface{}{"bad": func() {}})
+
+	if logged.Len() == 0 {
+		t.Fatal("expected writeJSON to log the Encode failure, got nothing")
+	}
+}
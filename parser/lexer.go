@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOperator
+	tokKeyword
+	tokPunct
+)
+
+type token struct {
+	typ tokenType
+	val string
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true,
+	"GROUP": true, "BY": true, "ORDER": true, "DESC": true, "ASC": true,
+	"LIMIT": true, "BETWEEN": true, "IN": true, "NOT": true,
+	"REGEXP": true, "EXISTS": true,
+}
+
+// lex scans query into a flat token stream, terminated by a tokEOF token.
+func lex(query string) ([]token, error) {
+	l := &lexer{input: []rune(query)}
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.typ == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func (l *lexer) peekRune() rune {
+	if l.pos >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos]
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+
+	if l.pos >= len(l.input) {
+		return token{typ: tokEOF}, nil
+	}
+
+	c := l.input[l.pos]
+
+	switch {
+	case c == '\'':
+		return l.scanString()
+	case unicode.IsDigit(c):
+		return l.scanNumber(), nil
+	case unicode.IsLetter(c) || c == '_':
+		return l.scanIdent(), nil
+	case strings.ContainsRune("(),", c):
+		l.pos++
+		return token{typ: tokPunct, val: string(c)}, nil
+	case strings.ContainsRune("=!<>*", c):
+		return l.scanOperator(), nil
+	}
+
+	return token{}, fmt.Errorf("parser: unexpected character %q at position %d", c, l.pos)
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *lexer) scanString() (token, error) {
+	l.pos++ // consume opening quote
+	start := l.pos
+	for l.pos < len(l.input) && l.input[l.pos] != '\'' {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return token{}, fmt.Errorf("parser: unterminated string literal")
+	}
+	val := string(l.input[start:l.pos])
+	l.pos++ // consume closing quote
+	return token{typ: tokString, val: val}, nil
+}
+
+// scanNumber reads a numeric literal and, when digits are immediately
+// followed by unit letters with no intervening space (e.g. "1m", "500ms"),
+// folds the unit into the same token so duration literals like time(1m)
+// can be handed straight to time.ParseDuration.
+func (l *lexer) scanNumber() token {
+	start := l.pos
+	for l.pos < len(l.input) && (unicode.IsDigit(l.input[l.pos]) || l.input[l.pos] == '.') {
+		l.pos++
+	}
+	for l.pos < len(l.input) && unicode.IsLetter(l.input[l.pos]) {
+		l.pos++
+	}
+	return token{typ: tokNumber, val: string(l.input[start:l.pos])}
+}
+
+func (l *lexer) scanIdent() token {
+	start := l.pos
+	for l.pos < len(l.input) && (unicode.IsLetter(l.input[l.pos]) || unicode.IsDigit(l.input[l.pos]) || l.input[l.pos] == '_') {
+		l.pos++
+	}
+	val := string(l.input[start:l.pos])
+	if keywords[strings.ToUpper(val)] {
+		return token{typ: tokKeyword, val: strings.ToUpper(val)}
+	}
+	return token{typ: tokIdent, val: val}
+}
+
+func (l *lexer) scanOperator() token {
+	start := l.pos
+	c := l.input[l.pos]
+	l.pos++
+	if l.pos < len(l.input) {
+		next := l.input[l.pos]
+		if (c == '!' && next == '=') || (c == '>' && next == '=') || (c == '<' && (next == '=' || next == '>')) {
+			l.pos++
+		}
+	}
+	return token{typ: tokOperator, val: string(l.input[start:l.pos])}
+}
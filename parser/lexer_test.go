@@ -0,0 +1,131 @@
+package parser
+
+import "testing"
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []token
+	}{
+		{
+			name:  "keyword and identifier",
+			query: "SELECT bytes",
+			want: []token{
+				{typ: tokKeyword, val: "SELECT"},
+				{typ: tokIdent, val: "bytes"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "keyword matching is case-insensitive but normalizes to upper",
+			query: "select",
+			want: []token{
+				{typ: tokKeyword, val: "SELECT"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "string literal",
+			query: "'hello world'",
+			want: []token{
+				{typ: tokString, val: "hello world"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "plain number",
+			query: "123.5",
+			want: []token{
+				{typ: tokNumber, val: "123.5"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "duration folds unit letters into the number token",
+			query: "1m",
+			want: []token{
+				{typ: tokNumber, val: "1m"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "duration with compound unit",
+			query: "500ms",
+			want: []token{
+				{typ: tokNumber, val: "500ms"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "punctuation",
+			query: "(a, b)",
+			want: []token{
+				{typ: tokPunct, val: "("},
+				{typ: tokIdent, val: "a"},
+				{typ: tokPunct, val: ","},
+				{typ: tokIdent, val: "b"},
+				{typ: tokPunct, val: ")"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "operators",
+			query: "= != <> > >= < <= *",
+			want: []token{
+				{typ: tokOperator, val: "="},
+				{typ: tokOperator, val: "!="},
+				{typ: tokOperator, val: "<>"},
+				{typ: tokOperator, val: ">"},
+				{typ: tokOperator, val: ">="},
+				{typ: tokOperator, val: "<"},
+				{typ: tokOperator, val: "<="},
+				{typ: tokOperator, val: "*"},
+				{typ: tokEOF},
+			},
+		},
+		{
+			name:  "underscore-prefixed identifier",
+			query: "_tag",
+			want: []token{
+				{typ: tokIdent, val: "_tag"},
+				{typ: tokEOF},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lex(tt.query)
+			if err != nil {
+				t.Fatalf("lex(%q): %v", tt.query, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lex(%q) = %d tokens, want %d: %v", tt.query, len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("lex(%q) token %d = %+v, want %+v", tt.query, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "unterminated string", query: "'unterminated"},
+		{name: "unexpected character", query: "bytes @ 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lex(tt.query); err == nil {
+				t.Fatalf("lex(%q): expected an error, got nil", tt.query)
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+// Package parser turns a small InfluxQL-inspired query language into an
+// eventstore.QueryDesc, so the store can be driven from a CLI or a single
+// query-string HTTP parameter instead of hand-built JSON.
+//
+// Grammar (uppercase words are literal keywords):
+//
+//	SELECT (* | column ("," column)*)
+//	FROM tag
+//	[WHERE condition (AND condition)*]
+//	[GROUP BY group ("," group)*]
+//	[ORDER BY column ("," column)* [DESC|ASC]]
+//	[LIMIT number]
+//	[BETWEEN 'time' AND 'time']
+//
+//	column    := ident | ident "(" ident ["," number] ")"
+//	condition := ident ["NOT"] "IN" "(" value ("," value)* ")"
+//	           | ident ["NOT"] "REGEXP" string
+//	           | "EXISTS" "(" ident ")" | "NOT" "EXISTS" "(" ident ")"
+//	           | ident operator value
+//	operator  := "=" | "!=" | "<>" | ">" | ">=" | "<" | "<="
+//	group     := ident | "time" "(" duration ")"
+//
+// column's optional aggregate function name maps to ColumnDesc.Aggregate;
+// "percentile(col, 95)" maps to the "percentile:95" aggregate. "time(1m)" in
+// GROUP BY maps to QueryDesc.PointSize in microseconds; every other GROUP BY
+// entry is pushed onto QueryDesc.GroupBy.
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Preetam/eventstore"
+)
+
+// Parse parses query and returns the equivalent eventstore.QueryDesc.
+func Parse(query string) (eventstore.QueryDesc, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return eventstore.QueryDesc{}, err
+	}
+	p := &parser{tokens: tokens}
+	desc, err := p.parseQuery()
+	if err != nil {
+		return eventstore.QueryDesc{}, err
+	}
+	return desc, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) cur() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if p.cur().typ != tokKeyword || p.cur().val != kw {
+		return fmt.Errorf("parser: expected %s, got %q", kw, p.cur().val)
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) peekKeyword(kw string) bool {
+	return p.cur().typ == tokKeyword && p.cur().val == kw
+}
+
+func (p *parser) expectPunct(val string) error {
+	if p.cur().typ != tokPunct || p.cur().val != val {
+		return fmt.Errorf("parser: expected %q, got %q", val, p.cur().val)
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	if p.cur().typ != tokIdent {
+		return "", fmt.Errorf("parser: expected identifier, got %q", p.cur().val)
+	}
+	return p.advance().val, nil
+}
+
+func (p *parser) parseQuery() (eventstore.QueryDesc, error) {
+	desc := eventstore.QueryDesc{}
+
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return desc, err
+	}
+	columns, err := p.parseColumnList()
+	if err != nil {
+		return desc, err
+	}
+	desc.Columns = columns
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return desc, err
+	}
+	tag, err := p.expectIdent()
+	if err != nil {
+		return desc, err
+	}
+	desc.Filters = append(desc.Filters, eventstore.Filter{Column: "_tag", Condition: "eq", Value: tag})
+
+	if p.peekKeyword("WHERE") {
+		p.advance()
+		filters, err := p.parseWhere()
+		if err != nil {
+			return desc, err
+		}
+		desc.Filters = append(desc.Filters, filters...)
+	}
+
+	if p.peekKeyword("GROUP") {
+		p.advance()
+		if err := p.expectKeyword("BY"); err != nil {
+			return desc, err
+		}
+		groupBy, pointSize, err := p.parseGroupBy()
+		if err != nil {
+			return desc, err
+		}
+		desc.GroupBy = groupBy
+		desc.PointSize = pointSize
+	}
+
+	if p.peekKeyword("ORDER") {
+		p.advance()
+		if err := p.expectKeyword("BY"); err != nil {
+			return desc, err
+		}
+		orderBy, descending, err := p.parseOrderBy()
+		if err != nil {
+			return desc, err
+		}
+		desc.OrderBy = orderBy
+		desc.Descending = descending
+	}
+
+	if p.peekKeyword("LIMIT") {
+		p.advance()
+		if p.cur().typ != tokNumber {
+			return desc, fmt.Errorf("parser: expected a number after LIMIT, got %q", p.cur().val)
+		}
+		limit, err := strconv.Atoi(p.advance().val)
+		if err != nil {
+			return desc, fmt.Errorf("parser: invalid LIMIT: %v", err)
+		}
+		desc.Limit = limit
+	}
+
+	if p.peekKeyword("BETWEEN") {
+		p.advance()
+		start, err := p.parseRFC3339()
+		if err != nil {
+			return desc, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return desc, err
+		}
+		end, err := p.parseRFC3339()
+		if err != nil {
+			return desc, err
+		}
+		desc.TimeRange = eventstore.TimeRange{Start: start, End: end}
+	}
+
+	if p.cur().typ != tokEOF {
+		return desc, fmt.Errorf("parser: unexpected trailing token %q", p.cur().val)
+	}
+
+	return desc, nil
+}
+
+func (p *parser) parseColumnList() ([]eventstore.ColumnDesc, error) {
+	if p.cur().typ == tokOperator && p.cur().val == "*" {
+		p.advance()
+		return nil, nil
+	}
+
+	var columns []eventstore.ColumnDesc
+	for {
+		col, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+		if p.cur().typ == tokPunct && p.cur().val == "," {
+			p.advance()
+			continue
+		}
+		break
+	}
+	return columns, nil
+}
+
+// parseColumn parses either a bare column name or an aggregate function call
+// like sum(bytes) or percentile(latency, 95).
+func (p *parser) parseColumn() (eventstore.ColumnDesc, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return eventstore.ColumnDesc{}, err
+	}
+
+	if p.cur().typ != tokPunct || p.cur().val != "(" {
+		return eventstore.ColumnDesc{Name: name}, nil
+	}
+
+	p.advance() // consume "("
+	colName, err := p.expectIdent()
+	if err != nil {
+		return eventstore.ColumnDesc{}, err
+	}
+
+	aggregate := name
+	if p.cur().typ == tokPunct && p.cur().val == "," {
+		p.advance()
+		if p.cur().typ != tokNumber {
+			return eventstore.ColumnDesc{}, fmt.Errorf("parser: expected a number in %s(), got %q", name, p.cur().val)
+		}
+		aggregate = fmt.Sprintf("%s:%s", name, p.advance().val)
+	}
+
+	if err := p.expectPunct(")"); err != nil {
+		return eventstore.ColumnDesc{}, err
+	}
+
+	return eventstore.ColumnDesc{Name: colName, Aggregate: aggregate}, nil
+}
+
+var comparisonOps = map[string]string{
+	"=": "eq", "!=": "neq", "<>": "neq",
+	">": "gt", ">=": "gte", "<": "lt", "<=": "lte",
+}
+
+func (p *parser) parseWhere() ([]eventstore.Filter, error) {
+	var filters []eventstore.Filter
+	for {
+		filter, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+
+		if p.peekKeyword("AND") {
+			p.advance()
+			continue
+		}
+		break
+	}
+	return filters, nil
+}
+
+func (p *parser) parseCondition() (eventstore.Filter, error) {
+	if p.peekKeyword("EXISTS") || p.peekKeyword("NOT") {
+		negate := false
+		if p.peekKeyword("NOT") {
+			negate = true
+			p.advance()
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return eventstore.Filter{}, err
+		}
+		if err := p.expectPunct("("); err != nil {
+			return eventstore.Filter{}, err
+		}
+		column, err := p.expectIdent()
+		if err != nil {
+			return eventstore.Filter{}, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return eventstore.Filter{}, err
+		}
+		condition := "exists"
+		if negate {
+			condition = "nexists"
+		}
+		return eventstore.Filter{Column: column, Condition: condition}, nil
+	}
+
+	column, err := p.expectIdent()
+	if err != nil {
+		return eventstore.Filter{}, err
+	}
+
+	negate := false
+	if p.peekKeyword("NOT") {
+		negate = true
+		p.advance()
+	}
+
+	switch {
+	case p.peekKeyword("IN"):
+		p.advance()
+		values, err := p.parseValueList()
+		if err != nil {
+			return eventstore.Filter{}, err
+		}
+		condition := "in"
+		if negate {
+			condition = "nin"
+		}
+		return eventstore.Filter{Column: column, Condition: condition, Value: values}, nil
+	case p.peekKeyword("REGEXP"):
+		p.advance()
+		if p.cur().typ != tokString {
+			return eventstore.Filter{}, fmt.Errorf("parser: expected a string pattern after REGEXP, got %q", p.cur().val)
+		}
+		pattern := p.advance().val
+		condition := "regex"
+		if negate {
+			condition = "nregex"
+		}
+		return eventstore.Filter{Column: column, Condition: condition, Value: pattern}, nil
+	}
+
+	if negate {
+		return eventstore.Filter{}, fmt.Errorf("parser: expected IN or REGEXP after NOT, got %q", p.cur().val)
+	}
+
+	if p.cur().typ != tokOperator {
+		return eventstore.Filter{}, fmt.Errorf("parser: expected a comparison operator, got %q", p.cur().val)
+	}
+	condition, ok := comparisonOps[p.advance().val]
+	if !ok {
+		return eventstore.Filter{}, fmt.Errorf("parser: unknown comparison operator %q", p.tokens[p.pos-1].val)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return eventstore.Filter{}, err
+	}
+
+	return eventstore.Filter{Column: column, Condition: condition, Value: value}, nil
+}
+
+func (p *parser) parseValueList() ([]interface{}, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.cur().typ == tokPunct && p.cur().val == "," {
+			p.advance()
+			continue
+		}
+		break
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	switch p.cur().typ {
+	case tokString:
+		return p.advance().val, nil
+	case tokNumber:
+		return strconv.ParseFloat(p.advance().val, 64)
+	}
+	return nil, fmt.Errorf("parser: expected a value, got %q", p.cur().val)
+}
+
+// parseGroupBy returns the plain GROUP BY columns and, if a time(duration)
+// entry was present, the corresponding PointSize in microseconds.
+func (p *parser) parseGroupBy() ([]string, int64, error) {
+	var groupBy []string
+	var pointSize int64
+
+	for {
+		ident, err := p.expectIdent()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if ident == "time" && p.cur().typ == tokPunct && p.cur().val == "(" {
+			p.advance()
+			if p.cur().typ != tokNumber {
+				return nil, 0, fmt.Errorf("parser: expected a duration in time(), got %q", p.cur().val)
+			}
+			dur, err := time.ParseDuration(p.advance().val)
+			if err != nil {
+				return nil, 0, fmt.Errorf("parser: invalid duration in time(): %v", err)
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, 0, err
+			}
+			pointSize = dur.Microseconds()
+		} else {
+			groupBy = append(groupBy, ident)
+		}
+
+		if p.cur().typ == tokPunct && p.cur().val == "," {
+			p.advance()
+			continue
+		}
+		break
+	}
+
+	return groupBy, pointSize, nil
+}
+
+// parseOrderBy returns the ORDER BY columns in the "agg(column)" shape used
+// by QueryDesc.OrderBy, plus whether DESC was given.
+func (p *parser) parseOrderBy() ([]string, bool, error) {
+	var orderBy []string
+	for {
+		col, err := p.parseColumn()
+		if err != nil {
+			return nil, false, err
+		}
+		if col.Aggregate != "" {
+			orderBy = append(orderBy, col.Aggregate+"("+col.Name+")")
+		} else {
+			orderBy = append(orderBy, col.Name)
+		}
+		if p.cur().typ == tokPunct && p.cur().val == "," {
+			p.advance()
+			continue
+		}
+		break
+	}
+
+	descending := false
+	if p.peekKeyword("DESC") {
+		p.advance()
+		descending = true
+	} else if p.peekKeyword("ASC") {
+		p.advance()
+	}
+
+	return orderBy, descending, nil
+}
+
+func (p *parser) parseRFC3339() (time.Time, error) {
+	if p.cur().typ != tokString {
+		return time.Time{}, fmt.Errorf("parser: expected a RFC 3339 timestamp string, got %q", p.cur().val)
+	}
+	return time.Parse(time.RFC3339, p.advance().val)
+}
@@ -0,0 +1,285 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Preetam/eventstore"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  eventstore.QueryDesc
+	}{
+		{
+			name:  "select star from tag",
+			query: "SELECT * FROM cpu",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+			},
+		},
+		{
+			name:  "aggregate column",
+			query: "SELECT sum(bytes) FROM cpu",
+			want: eventstore.QueryDesc{
+				Columns: []eventstore.ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+			},
+		},
+		{
+			name:  "percentile aggregate folds its argument into the aggregate name",
+			query: "SELECT percentile(latency, 95) FROM cpu",
+			want: eventstore.QueryDesc{
+				Columns: []eventstore.ColumnDesc{{Name: "latency", Aggregate: "percentile:95"}},
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+			},
+		},
+		{
+			name:  "multiple columns",
+			query: "SELECT sum(bytes), count(bytes) FROM cpu",
+			want: eventstore.QueryDesc{
+				Columns: []eventstore.ColumnDesc{
+					{Name: "bytes", Aggregate: "sum"},
+					{Name: "bytes", Aggregate: "count"},
+				},
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+			},
+		},
+		{
+			name:  "where with comparison operators",
+			query: "SELECT * FROM cpu WHERE host = 'a' AND value != 1 AND value > 0",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{
+					{Column: "_tag", Condition: "eq", Value: "cpu"},
+					{Column: "host", Condition: "eq", Value: "a"},
+					{Column: "value", Condition: "neq", Value: 1.0},
+					{Column: "value", Condition: "gt", Value: 0.0},
+				},
+			},
+		},
+		{
+			name:  "where in and not in",
+			query: "SELECT * FROM cpu WHERE host IN ('a', 'b') AND region NOT IN ('us')",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{
+					{Column: "_tag", Condition: "eq", Value: "cpu"},
+					{Column: "host", Condition: "in", Value: []interface{}{"a", "b"}},
+					{Column: "region", Condition: "nin", Value: []interface{}{"us"}},
+				},
+			},
+		},
+		{
+			name:  "where regexp and not regexp",
+			query: "SELECT * FROM cpu WHERE host REGEXP 'a.*' AND host NOT REGEXP 'b.*'",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{
+					{Column: "_tag", Condition: "eq", Value: "cpu"},
+					{Column: "host", Condition: "regex", Value: "a.*"},
+					{Column: "host", Condition: "nregex", Value: "b.*"},
+				},
+			},
+		},
+		{
+			name:  "where exists and not exists",
+			query: "SELECT * FROM cpu WHERE EXISTS(host) AND NOT EXISTS(region)",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{
+					{Column: "_tag", Condition: "eq", Value: "cpu"},
+					{Column: "host", Condition: "exists"},
+					{Column: "region", Condition: "nexists"},
+				},
+			},
+		},
+		{
+			name:  "group by plain columns",
+			query: "SELECT sum(bytes) FROM cpu GROUP BY host, region",
+			want: eventstore.QueryDesc{
+				Columns: []eventstore.ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				GroupBy: []string{"host", "region"},
+			},
+		},
+		{
+			name:  "group by time folds a duration into PointSize",
+			query: "SELECT sum(bytes) FROM cpu GROUP BY host, time(1m)",
+			want: eventstore.QueryDesc{
+				Columns:   []eventstore.ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+				Filters:   []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				GroupBy:   []string{"host"},
+				PointSize: time.Minute.Microseconds(),
+			},
+		},
+		{
+			name:  "order by with desc",
+			query: "SELECT sum(bytes) FROM cpu ORDER BY sum(bytes) DESC",
+			want: eventstore.QueryDesc{
+				Columns:    []eventstore.ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+				Filters:    []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				OrderBy:    []string{"sum(bytes)"},
+				Descending: true,
+			},
+		},
+		{
+			name:  "order by bare column with asc",
+			query: "SELECT * FROM cpu ORDER BY host ASC",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				OrderBy: []string{"host"},
+			},
+		},
+		{
+			name:  "limit",
+			query: "SELECT * FROM cpu LIMIT 10",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				Limit:   10,
+			},
+		},
+		{
+			name:  "between",
+			query: "SELECT * FROM cpu BETWEEN '2024-01-01T00:00:00Z' AND '2024-01-02T00:00:00Z'",
+			want: eventstore.QueryDesc{
+				Filters: []eventstore.Filter{{Column: "_tag", Condition: "eq", Value: "cpu"}},
+				TimeRange: eventstore.TimeRange{
+					Start: mustParseRFC3339(t, "2024-01-01T00:00:00Z"),
+					End:   mustParseRFC3339(t, "2024-01-02T00:00:00Z"),
+				},
+			},
+		},
+		{
+			name:  "full grammar combined",
+			query: "SELECT sum(bytes) FROM cpu WHERE host = 'a' GROUP BY time(1m) ORDER BY sum(bytes) DESC LIMIT 5 BETWEEN '2024-01-01T00:00:00Z' AND '2024-01-02T00:00:00Z'",
+			want: eventstore.QueryDesc{
+				Columns: []eventstore.ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+				Filters: []eventstore.Filter{
+					{Column: "_tag", Condition: "eq", Value: "cpu"},
+					{Column: "host", Condition: "eq", Value: "a"},
+				},
+				PointSize:  time.Minute.Microseconds(),
+				OrderBy:    []string{"sum(bytes)"},
+				Descending: true,
+				Limit:      5,
+				TimeRange: eventstore.TimeRange{
+					Start: mustParseRFC3339(t, "2024-01-01T00:00:00Z"),
+					End:   mustParseRFC3339(t, "2024-01-02T00:00:00Z"),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.query, err)
+			}
+			if !queryDescsEqual(got, tt.want) {
+				t.Errorf("Parse(%q) =\n  %+v\nwant\n  %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing SELECT", query: "FROM cpu"},
+		{name: "missing FROM", query: "SELECT *"},
+		{name: "missing tag after FROM", query: "SELECT * FROM"},
+		{name: "trailing garbage", query: "SELECT * FROM cpu extra"},
+		{name: "non-numeric LIMIT", query: "SELECT * FROM cpu LIMIT abc"},
+		{name: "NOT without IN or REGEXP", query: "SELECT * FROM cpu WHERE host NOT = 'a'"},
+		{name: "unknown comparison operator", query: "SELECT * FROM cpu WHERE host * 'a'"},
+		{name: "invalid duration in time()", query: "SELECT * FROM cpu GROUP BY time(nope)"},
+		{name: "between with non-string timestamp", query: "SELECT * FROM cpu BETWEEN 1 AND 2"},
+		{name: "malformed RFC3339 timestamp", query: "SELECT * FROM cpu BETWEEN 'not-a-time' AND 'not-a-time'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.query); err == nil {
+				t.Fatalf("Parse(%q): expected an error, got nil", tt.query)
+			}
+		})
+	}
+}
+
+func mustParseRFC3339(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+// queryDescsEqual compares the fields Parse actually populates. It avoids
+// reflect.DeepEqual so a nil vs. empty slice distinction (Filters always
+// has at least the _tag entry, but Columns/GroupBy/OrderBy are nil when
+// absent from the query) doesn't make an otherwise-correct test fail.
+func queryDescsEqual(a, b eventstore.QueryDesc) bool {
+	if len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i] != b.Columns[i] {
+			return false
+		}
+	}
+	if len(a.Filters) != len(b.Filters) {
+		return false
+	}
+	for i := range a.Filters {
+		fa, fb := a.Filters[i], b.Filters[i]
+		if fa.Column != fb.Column || fa.Condition != fb.Condition {
+			return false
+		}
+		if !valuesEqual(fa.Value, fb.Value) {
+			return false
+		}
+	}
+	if len(a.GroupBy) != len(b.GroupBy) {
+		return false
+	}
+	for i := range a.GroupBy {
+		if a.GroupBy[i] != b.GroupBy[i] {
+			return false
+		}
+	}
+	if len(a.OrderBy) != len(b.OrderBy) {
+		return false
+	}
+	for i := range a.OrderBy {
+		if a.OrderBy[i] != b.OrderBy[i] {
+			return false
+		}
+	}
+	return a.PointSize == b.PointSize &&
+		a.Descending == b.Descending &&
+		a.Limit == b.Limit &&
+		a.TimeRange == b.TimeRange
+}
+
+func valuesEqual(a, b interface{}) bool {
+	aList, aOK := a.([]interface{})
+	bList, bOK := b.([]interface{})
+	if aOK != bOK {
+		return false
+	}
+	if aOK {
+		if len(aList) != len(bList) {
+			return false
+		}
+		for i := range aList {
+			if aList[i] != bList[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
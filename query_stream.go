@@ -0,0 +1,216 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryChunk is a bounded slice of a Query result, using the same flattened
+// Event shape as the legacy QueryResult (see QueryDesc.LegacyFormat) rather
+// than GroupedQueryResult, since NDJSON streaming wants one flat record per
+// line, not a nested Group/Row tree.
+//
+// QueryStream and QueryContext emit a QueryChunk on out every time they've
+// accumulated chunkSize worth of raw Events, so a caller can page through a
+// range of ungrouped events without holding the full result set in memory.
+// Summary and Series are the exception: a GroupBy row key can recur later in
+// the scan (another event for the same group), and fillSeries needs the
+// complete time-bucket range to backfill gaps -- both need the whole scan to
+// produce a correct value, the same way Query does, so Summary and Series
+// are only ever sent once, complete, together in the final chunk, never
+// chunked progressively like Events. QueryChunk.Summary also doesn't apply
+// QueryDesc.OrderBy/Limit, since both need the complete result set too; use
+// Query instead of streaming if you need either.
+type QueryChunk struct {
+	Events  []Event `json:"events,omitempty"`
+	Summary []Event `json:"summary,omitempty"`
+	Series  []Event `json:"series,omitempty"`
+}
+
+// QueryStream is like Query, but walks the lm2 cursor and writes bounded
+// QueryChunks to out instead of materializing the whole result in memory.
+// out is closed when the scan finishes or an error occurs.
+func (c *EventCollection) QueryStream(desc QueryDesc, chunkSize int, out chan<- QueryChunk) error {
+	return c.QueryContext(context.Background(), desc, chunkSize, out)
+}
+
+// QueryContext is QueryStream with a context, so a long-running scan over a
+// large time range can be cancelled from the cursor loop.
+func (c *EventCollection) QueryContext(ctx context.Context, desc QueryDesc, chunkSize int, out chan<- QueryChunk) error {
+	defer close(out)
+
+	if chunkSize <= 0 {
+		return errors.New("chunkSize must be positive")
+	}
+
+	if desc.TimeRange.Start == minTimestamp && desc.TimeRange.End == minTimestamp {
+		desc.TimeRange.End = fromMicrosecondTime(math.MaxInt64)
+	}
+
+	aggregating := len(desc.Columns) > 0 || len(desc.GroupBy) > 0 || desc.PointSize > 0
+
+	eventsBuf := []Event{}
+	summaryRows := map[string][]aggregatorState{}
+	summaryRowsByTime := map[int64]map[string][]aggregatorState{}
+
+	flush := func() error {
+		if len(eventsBuf) == 0 {
+			return nil
+		}
+		chunk := QueryChunk{Events: eventsBuf}
+		eventsBuf = []Event{}
+		select {
+		case out <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// finalFlush flushes whatever Events remain, then sends Summary and
+	// Series together in one last chunk. Both need the whole scan: a
+	// GroupBy row key can recur later in the scan, so flushing and
+	// resetting summaryRows early would silently drop the prior partial
+	// aggregate for any group whose events straddle the flush; fillSeries
+	// (QueryDesc.Fill) separately needs the complete time-bucket range to
+	// backfill gaps. Query has the same requirements and only finalizes
+	// both after its scan completes too.
+	finalFlush := func() error {
+		if err := flush(); err != nil {
+			return err
+		}
+
+		chunk := QueryChunk{}
+		if len(summaryRows) > 0 {
+			chunk.Summary = rowsToEvents(desc, summaryRows)
+		}
+		if len(summaryRowsByTime) > 0 {
+			seriesEvents := seriesRowsToEvents(desc, summaryRowsByTime)
+			seriesEvents = fillSeries(desc, seriesEvents)
+			sort.Slice(seriesEvents, func(i, j int) bool {
+				ti := seriesEvents[i]["_ts"].(time.Time)
+				tj := seriesEvents[j]["_ts"].(time.Time)
+				if !ti.Equal(tj) {
+					return ti.Before(tj)
+				}
+				return seriesRowKey(desc, seriesEvents[i]) < seriesRowKey(desc, seriesEvents[j])
+			})
+			chunk.Series = seriesEvents
+		}
+		if len(chunk.Summary) == 0 && len(chunk.Series) == 0 {
+			return nil
+		}
+
+		select {
+		case out <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := c.cursorWalk(ctx, desc, func(event Event, ts int64, rowKey string) error {
+		if !aggregating {
+			event["_ts"] = fromMicrosecondTime(ts)
+			eventsBuf = append(eventsBuf, event)
+			if len(eventsBuf) >= chunkSize {
+				return flush()
+			}
+			return nil
+		}
+
+		if len(desc.Columns) > 0 {
+			if err := updateAggregateRow(desc, event, ts, rowKey, summaryRows); err != nil {
+				return err
+			}
+		}
+
+		if desc.PointSize > 0 {
+			timeGroup := ts / desc.PointSize
+			rows, ok := summaryRowsByTime[timeGroup]
+			if !ok {
+				rows = map[string][]aggregatorState{}
+				summaryRowsByTime[timeGroup] = rows
+			}
+			if err := updateAggregateRow(desc, event, ts, rowKey, rows); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return finalFlush()
+}
+
+// rowsToEvents converts a summaryRows map from the cursor loop into the same
+// Event shape Query returns in QueryResult.Summary.
+func rowsToEvents(desc QueryDesc, summaryRows map[string][]aggregatorState) []Event {
+	events := []Event{}
+	for rowKey, rowAggregates := range summaryRows {
+		event := Event{}
+		if len(desc.GroupBy) > 0 {
+			parts := strings.Split(rowKey, "\x00")
+			for i, part := range parts {
+				if desc.GroupBy[i] == "_ts" {
+					ts, _ := strconv.Atoi(part)
+					event["_ts"] = fromMicrosecondTime(int64(ts))
+					continue
+				}
+				var val interface{}
+				dec := json.NewDecoder(strings.NewReader(part))
+				dec.UseNumber()
+				dec.Decode(&val)
+				event[desc.GroupBy[i]] = val
+			}
+		}
+		for i, columnDesc := range desc.Columns {
+			fieldName := columnDesc.Aggregate + "(" + columnDesc.Name + ")"
+			event[fieldName] = rowAggregates[i].Result()
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// seriesRowsToEvents converts a summaryRowsByTime map from the cursor loop
+// into the same Event shape Query returns in QueryResult.Series.
+func seriesRowsToEvents(desc QueryDesc, summaryRowsByTime map[int64]map[string][]aggregatorState) []Event {
+	events := []Event{}
+	for ts, rows := range summaryRowsByTime {
+		for rowKey, rowAggregates := range rows {
+			event := Event{
+				"_ts": fromMicrosecondTime(ts * desc.PointSize),
+			}
+			if len(desc.GroupBy) > 0 {
+				parts := strings.Split(rowKey, "\x00")
+				for i, part := range parts {
+					if desc.GroupBy[i] == "_ts" {
+						continue
+					}
+					var val interface{}
+					dec := json.NewDecoder(strings.NewReader(part))
+					dec.UseNumber()
+					dec.Decode(&val)
+					event[desc.GroupBy[i]] = val
+				}
+			}
+			for i, columnDesc := range desc.Columns {
+				fieldName := columnDesc.Aggregate + "(" + columnDesc.Name + ")"
+				event[fieldName] = rowAggregates[i].Result()
+			}
+			events = append(events, event)
+		}
+	}
+	sort.Sort(ByTimestamp(events))
+	return events
+}
@@ -0,0 +1,143 @@
+package eventstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestQueryContextMergesSummaryRowsAcrossFlushes guards against a group's
+// aggregate being silently split across chunks: a rowKey that recurs after a
+// flush must keep accumulating into the same aggregatorState, not start
+// over from zero.
+func TestQueryContextMergesSummaryRowsAcrossFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	events := []Event{}
+	hosts := []string{"a", "b", "a", "b", "a"}
+	for i, host := range hosts {
+		events = append(events, Event{
+			"_ts":   now.Add(time.Duration(i) * time.Millisecond).Format(time.RFC3339Nano),
+			"host":  host,
+			"bytes": 1.0,
+		})
+	}
+	if _, err := col.StoreEvents(CreateEventsRequest{Tag: "raw", Events: events}); err != nil {
+		t.Fatal(err)
+	}
+
+	desc := QueryDesc{
+		TimeRange: TimeRange{Start: now.Add(-time.Second), End: now.Add(time.Second)},
+		Filters:   []Filter{{Column: "_tag", Condition: "eq", Value: "raw"}},
+		GroupBy:   []string{"host"},
+		Columns:   []ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+	}
+
+	out := make(chan QueryChunk)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- col.QueryContext(context.Background(), desc, 2, out)
+	}()
+
+	totals := map[string]interface{}{}
+	rowsSeen := 0
+	for chunk := range out {
+		for _, row := range chunk.Summary {
+			rowsSeen++
+			totals[row["host"].(string)] = row["sum(bytes)"]
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if rowsSeen != 2 {
+		t.Fatalf("expected exactly one Summary row per host (2 total), got %d", rowsSeen)
+	}
+	if totals["a"] != 3.0 {
+		t.Errorf("expected sum(bytes)=3 for host a, got %v", totals["a"])
+	}
+	if totals["b"] != 2.0 {
+		t.Errorf("expected sum(bytes)=2 for host b, got %v", totals["b"])
+	}
+}
+
+// TestQueryContextFillsSeriesLikeQuery guards against QueryContext's cursor
+// loop drifting from Query's again: before the two shared a cursorWalk,
+// QueryContext silently ignored QueryDesc.Fill and returned a ragged series
+// wherever Query would have backfilled a gap bucket.
+func TestQueryContextFillsSeriesLikeQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().UTC().Truncate(time.Minute)
+
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "raw",
+		Events: []Event{
+			{"_ts": start.Format(time.RFC3339Nano), "bytes": 10.0},
+			// start+1m has no events -- Fill:"zero" must backfill the gap.
+			{"_ts": start.Add(2 * time.Minute).Format(time.RFC3339Nano), "bytes": 20.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := QueryDesc{
+		TimeRange:    TimeRange{Start: start, End: start.Add(2 * time.Minute)},
+		Filters:      []Filter{{Column: "_tag", Condition: "eq", Value: "raw"}},
+		Columns:      []ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+		PointSize:    int64(time.Minute / time.Microsecond),
+		Fill:         "zero",
+		LegacyFormat: true,
+	}
+
+	raw, err := col.Query(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSeries := raw.(QueryResult).Series
+	if len(wantSeries) != 3 {
+		t.Fatalf("expected Query to fill 3 buckets, got %d", len(wantSeries))
+	}
+
+	out := make(chan QueryChunk)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- col.QueryContext(context.Background(), desc, 1, out)
+	}()
+
+	seriesChunks := 0
+	var gotSeries []Event
+	for chunk := range out {
+		if len(chunk.Series) > 0 {
+			seriesChunks++
+			gotSeries = chunk.Series
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if seriesChunks != 1 {
+		t.Fatalf("expected Series in exactly one chunk, got %d chunks with Series", seriesChunks)
+	}
+	if len(gotSeries) != len(wantSeries) {
+		t.Fatalf("expected %d filled series points from QueryContext, got %d", len(wantSeries), len(gotSeries))
+	}
+	for i := range wantSeries {
+		if gotSeries[i]["sum(bytes)"] != wantSeries[i]["sum(bytes)"] {
+			t.Errorf("point %d: QueryContext sum(bytes)=%v, Query sum(bytes)=%v", i, gotSeries[i]["sum(bytes)"], wantSeries[i]["sum(bytes)"])
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Preetam/lm2"
+)
+
+const (
+	// retentionTickInterval is how often StartRetention wakes up to check
+	// whether any DownsampleRule is due to run.
+	retentionTickInterval = time.Second
+
+	// retentionSweepInterval is how often each RetentionRule's MaxAge sweep
+	// runs. It's coarser than retentionTickInterval because a sweep walks
+	// every event key in the collection.
+	retentionSweepInterval = time.Minute
+
+	// retentionDeleteBatchSize caps how many deletes accumulate in a single
+	// lm2 WriteBatch during a sweep, so a large backlog doesn't build one
+	// unbounded batch.
+	retentionDeleteBatchSize = 1000
+)
+
+// DownsampleRule continuously re-aggregates events from SourceTag into
+// DestTag: every Every, Query runs with Query's TimeRange set to the last
+// Window and its results are stored back into DestTag via StoreEvents.
+type DownsampleRule struct {
+	SourceTag string        `json:"source_tag"`
+	DestTag   string        `json:"dest_tag"`
+	Every     time.Duration `json:"every"`
+	Window    time.Duration `json:"window"`
+	Query     QueryDesc     `json:"query"`
+}
+
+// RetentionRule deletes events in Tag older than MaxAge.
+type RetentionRule struct {
+	Tag    string        `json:"tag"`
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// RegisterDownsampleRule persists rule so it survives restarts and is
+// picked up the next time StartRetention is called.
+func (c *EventCollection) RegisterDownsampleRule(rule DownsampleRule) error {
+	marshalled, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	wb := lm2.NewWriteBatch()
+	wb.Set(downsampleRuleKey(rule.SourceTag, rule.DestTag), string(marshalled))
+
+	_, err = c.lm2Col.Update(wb)
+	return err
+}
+
+// RegisterRetentionRule persists rule so it survives restarts and is picked
+// up the next time StartRetention is called.
+func (c *EventCollection) RegisterRetentionRule(rule RetentionRule) error {
+	marshalled, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	wb := lm2.NewWriteBatch()
+	wb.Set(retentionRuleKey(rule.Tag), string(marshalled))
+
+	_, err = c.lm2Col.Update(wb)
+	return err
+}
+
+// StartRetention loads the rules registered via RegisterDownsampleRule and
+// RegisterRetentionRule and runs them in a background goroutine until ctx is
+// done.
+func (c *EventCollection) StartRetention(ctx context.Context) error {
+	rules, err := c.loadRetentionRules()
+	if err != nil {
+		return err
+	}
+
+	go c.runRetention(ctx, rules)
+	return nil
+}
+
+type retentionRules struct {
+	downsample []DownsampleRule
+	retention  []RetentionRule
+}
+
+func (c *EventCollection) runRetention(ctx context.Context, rules retentionRules) {
+	ticker := time.NewTicker(retentionTickInterval)
+	defer ticker.Stop()
+
+	lastDownsample := map[string]time.Time{}
+	lastSweep := map[string]time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, rule := range rules.downsample {
+				key := rule.SourceTag + "->" + rule.DestTag
+				if now.Sub(lastDownsample[key]) < rule.Every {
+					continue
+				}
+				lastDownsample[key] = now
+				if err := c.runDownsampleRule(rule, now); err != nil {
+					log.Println(err)
+				}
+			}
+
+			for _, rule := range rules.retention {
+				if now.Sub(lastSweep[rule.Tag]) < retentionSweepInterval {
+					continue
+				}
+				lastSweep[rule.Tag] = now
+				if err := c.runRetentionSweep(rule, now); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func (c *EventCollection) runDownsampleRule(rule DownsampleRule, now time.Time) error {
+	desc := rule.Query
+	desc.TimeRange = TimeRange{Start: now.Add(-rule.Window), End: now}
+	// Downsampling needs Summary/Series Event maps to re-store directly, so
+	// ask Query for the legacy format rather than GroupedQueryResult.
+	desc.LegacyFormat = true
+
+	// Scope the query to SourceTag. Without this, the rule would aggregate
+	// every tag in the collection into DestTag.
+	filters := make([]Filter, len(desc.Filters)+1)
+	copy(filters, desc.Filters)
+	filters[len(filters)-1] = Filter{Column: "_tag", Condition: "eq", Value: rule.SourceTag}
+	desc.Filters = filters
+
+	raw, err := c.Query(desc)
+	if err != nil {
+		return err
+	}
+
+	result, ok := raw.(QueryResult)
+	if !ok {
+		return errors.New("eventstore: unexpected Query result type")
+	}
+
+	events := result.Summary
+	if desc.PointSize > 0 {
+		events = result.Series
+	}
+	if len(events) == 0 {
+		events = result.Events
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		delete(event, "_tag")
+
+		// Query's Summary/Series events carry "_ts" as a time.Time (or omit
+		// it entirely when PointSize <= 0 and GroupBy doesn't include
+		// "_ts"), but StoreEvents requires it formatted as an RFC3339Nano
+		// string.
+		ts, ok := event["_ts"].(time.Time)
+		if !ok {
+			ts = now
+		}
+		event["_ts"] = ts.Format(time.RFC3339Nano)
+	}
+
+	_, err = c.StoreEvents(CreateEventsRequest{Tag: rule.DestTag, Events: events})
+	return err
+}
+
+func (c *EventCollection) runRetentionSweep(rule RetentionRule, now time.Time) error {
+	cutoff := toMicrosecondTime(now.Add(-rule.MaxAge))
+
+	cur, err := c.lm2Col.NewCursor()
+	if err != nil {
+		return err
+	}
+
+	startKey := string(eventKeyPrefix)
+	cur.Seek(startKey)
+
+	wb := lm2.NewWriteBatch()
+	pending := 0
+
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if _, err := c.lm2Col.Update(wb); err != nil {
+			return err
+		}
+		wb = lm2.NewWriteBatch()
+		pending = 0
+		return nil
+	}
+
+	for cur.Next() {
+		key := cur.Key()
+		if len(key) == 0 {
+			break
+		}
+		// Seek positions the cursor at the last key <= startKey, which can
+		// land on a record from an earlier-sorting prefix (there isn't one
+		// smaller than eventKeyPrefix today, but nothing guarantees that);
+		// skip forward past it instead of mistaking it for "scan exhausted".
+		if key[0] < eventKeyPrefix {
+			continue
+		}
+		if key[0] != eventKeyPrefix {
+			break
+		}
+
+		ts, tag, _, err := splitCollectionID(key)
+		if err != nil {
+			continue
+		}
+		if tag != rule.Tag || ts >= cutoff {
+			continue
+		}
+
+		wb.Delete(key)
+		pending++
+		if pending >= retentionDeleteBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// loadRetentionRules scans the 'r'-prefixed keys written by
+// RegisterDownsampleRule and RegisterRetentionRule.
+func (c *EventCollection) loadRetentionRules() (retentionRules, error) {
+	var rules retentionRules
+
+	cur, err := c.lm2Col.NewCursor()
+	if err != nil {
+		return rules, err
+	}
+
+	startKey := string(retentionKeyPrefix)
+	cur.Seek(startKey)
+
+	for cur.Next() {
+		key := cur.Key()
+		if len(key) == 0 {
+			break
+		}
+		// Seek positions the cursor at the last key <= startKey, not the
+		// first key >= startKey: with any event recorded (eventKeyPrefix
+		// 'e' sorts before retentionKeyPrefix 'r'), the cursor lands on the
+		// last event key first. That key must be skipped forward past, not
+		// mistaken for "the retention range is empty".
+		if key[0] < retentionKeyPrefix {
+			continue
+		}
+		if key[0] != retentionKeyPrefix {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(key, downsampleRuleKeyPrefix()):
+			var rule DownsampleRule
+			if err := json.Unmarshal([]byte(cur.Value()), &rule); err != nil {
+				return rules, err
+			}
+			rules.downsample = append(rules.downsample, rule)
+		case strings.HasPrefix(key, retentionRuleKeyPrefix()):
+			var rule RetentionRule
+			if err := json.Unmarshal([]byte(cur.Value()), &rule); err != nil {
+				return rules, err
+			}
+			rules.retention = append(rules.retention, rule)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+func downsampleRuleKeyPrefix() string {
+	return string(retentionKeyPrefix) + "-ds-"
+}
+
+func retentionRuleKeyPrefix() string {
+	return string(retentionKeyPrefix) + "-rt-"
+}
+
+func downsampleRuleKey(sourceTag, destTag string) string {
+	return downsampleRuleKeyPrefix() + sourceTag + "-" + destTag
+}
+
+func retentionRuleKey(tag string) string {
+	return retentionRuleKeyPrefix() + tag
+}
@@ -0,0 +1,241 @@
+package eventstore
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunDownsampleRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "raw",
+		Events: []Event{
+			{"_ts": now.Format(time.RFC3339Nano), "bytes": 10.0},
+			{"_ts": now.Add(time.Millisecond).Format(time.RFC3339Nano), "bytes": 20.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An event on a different tag -- must not leak into the downsampled
+	// destination for "raw".
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "other",
+		Events: []Event{
+			{"_ts": now.Format(time.RFC3339Nano), "bytes": 1000.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := DownsampleRule{
+		SourceTag: "raw",
+		DestTag:   "raw_1m",
+		Every:     time.Minute,
+		Window:    time.Hour,
+		Query: QueryDesc{
+			Columns: []ColumnDesc{{Name: "bytes", Aggregate: "sum"}},
+		},
+	}
+
+	if err := col.runDownsampleRule(rule, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := col.Version("raw_1m")
+	if err != nil {
+		t.Fatalf("dest tag version: %v", err)
+	}
+	if version != 1 {
+		t.Fatalf("expected dest tag version 1, got %d", version)
+	}
+
+	result, err := col.Query(QueryDesc{
+		LegacyFormat: true,
+		TimeRange:    TimeRange{Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+		Filters:      []Filter{{Column: "_tag", Condition: "eq", Value: "raw_1m"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := result.(QueryResult).Events
+	if len(events) != 1 {
+		t.Fatalf("expected 1 downsampled event, got %d", len(events))
+	}
+	if got := events[0]["sum(bytes)"]; got != 30.0 {
+		t.Fatalf("expected sum(bytes)=30, got %v", got)
+	}
+}
+
+func TestRunRetentionSweep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "raw",
+		Events: []Event{
+			{"_ts": now.Add(-2 * time.Hour).Format(time.RFC3339Nano), "bytes": 1.0},
+			{"_ts": now.Format(time.RFC3339Nano), "bytes": 2.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An event on a different tag, older than MaxAge too -- must survive the
+	// sweep since the rule only scopes "raw".
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "other",
+		Events: []Event{
+			{"_ts": now.Add(-2 * time.Hour).Format(time.RFC3339Nano), "bytes": 1000.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := RetentionRule{Tag: "raw", MaxAge: time.Hour}
+	if err := col.runRetentionSweep(rule, now); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := col.Query(QueryDesc{
+		LegacyFormat: true,
+		TimeRange:    TimeRange{Start: now.Add(-24 * time.Hour), End: now.Add(time.Hour)},
+		Filters:      []Filter{{Column: "_tag", Condition: "eq", Value: "raw"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := result.(QueryResult).Events
+	if len(events) != 1 {
+		t.Fatalf("expected the stale \"raw\" event to be swept, got %d events left", len(events))
+	}
+	if got := events[0]["bytes"]; got != 2.0 {
+		t.Fatalf("expected the surviving event to be the recent one (bytes=2), got %v", got)
+	}
+
+	result, err = col.Query(QueryDesc{
+		LegacyFormat: true,
+		TimeRange:    TimeRange{Start: now.Add(-24 * time.Hour), End: now.Add(time.Hour)},
+		Filters:      []Filter{{Column: "_tag", Condition: "eq", Value: "other"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(result.(QueryResult).Events); got != 1 {
+		t.Fatalf("expected the \"other\" tag event to survive a sweep scoped to \"raw\", got %d events", got)
+	}
+}
+
+// TestLoadRetentionRulesRoundTrip guards the loadRetentionRules/
+// RegisterDownsampleRule/RegisterRetentionRule persistence path: rules
+// registered before a restart must be read back intact so StartRetention can
+// pick them up again.
+func TestLoadRetentionRulesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downsampleRule := DownsampleRule{
+		SourceTag: "raw",
+		DestTag:   "raw_1m",
+		Every:     time.Minute,
+		Window:    time.Hour,
+		Query:     QueryDesc{Columns: []ColumnDesc{{Name: "bytes", Aggregate: "sum"}}},
+	}
+	if err := col.RegisterDownsampleRule(downsampleRule); err != nil {
+		t.Fatal(err)
+	}
+
+	retentionRule := RetentionRule{Tag: "raw", MaxAge: 24 * time.Hour}
+	if err := col.RegisterRetentionRule(retentionRule); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := col.loadRetentionRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules.downsample) != 1 || !reflect.DeepEqual(rules.downsample[0], downsampleRule) {
+		t.Fatalf("expected the registered downsample rule back unchanged, got %+v", rules.downsample)
+	}
+	if len(rules.retention) != 1 || rules.retention[0] != retentionRule {
+		t.Fatalf("expected the registered retention rule back unchanged, got %+v", rules.retention)
+	}
+}
+
+// TestStartRetentionRunsRegisteredRules is an end-to-end smoke test of
+// StartRetention: a registered DownsampleRule should actually run in the
+// background goroutine it starts, without the caller manually invoking
+// runDownsampleRule.
+func TestStartRetentionRunsRegisteredRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.lm2")
+	col, err := CreateEventCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	_, err = col.StoreEvents(CreateEventsRequest{
+		Tag: "raw",
+		Events: []Event{
+			{"_ts": now.Format(time.RFC3339Nano), "bytes": 10.0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := DownsampleRule{
+		SourceTag: "raw",
+		DestTag:   "raw_1m",
+		Every:     time.Millisecond,
+		Window:    time.Hour,
+		Query:     QueryDesc{Columns: []ColumnDesc{{Name: "bytes", Aggregate: "sum"}}},
+	}
+	if err := col.RegisterDownsampleRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := col.StartRetention(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		version, err := col.Version("raw_1m")
+		if err == nil && version > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("StartRetention didn't run the registered downsample rule in time: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}